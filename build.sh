@@ -1,2 +1,2 @@
-go build -ldflags="-s -w" -o kgcr main.go
+go build -ldflags="-s -w -X main.version=$(git describe --tags --always --dirty)" -o kgcr ./cmd/kgcr
 sudo mv kgcr /usr/local/bin/
\ No newline at end of file
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+
+	"kgcr/internal/config"
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// auditSeverities rank the findings of `kgcr audit`, most severe first.
+var auditSeverities = []string{"high", "medium", "low"}
+
+// auditFinding is one issue in the `kgcr audit` report. Findings about a whole CRD have no
+// namespace or name.
+type auditFinding struct {
+	Severity  string `json:"severity"`
+	Check     string `json:"check"`
+	CRD       string `json:"crd"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Message   string `json:"message"`
+}
+
+// crdFindings checks the scanned CRDs for deprecated versions, stored versions other than
+// the storage version and, from counts of instances per CRD, CRDs without any instance.
+// CRDs whose list call failed are not reported as empty.
+func crdFindings(crds []*apiextensionsv1.CustomResourceDefinition, counts map[string]int, failed map[string]bool, scope string) []auditFinding {
+	var findings []auditFinding
+	for _, crd := range crds {
+		storage := ""
+		served := map[string]bool{}
+		for _, v := range crd.Spec.Versions {
+			if v.Storage {
+				storage = v.Name
+			}
+			served[v.Name] = v.Served
+		}
+
+		for _, v := range crd.Spec.Versions {
+			if !v.Deprecated || !v.Served {
+				continue
+			}
+			f := auditFinding{Severity: "low", Check: "deprecated-version", CRD: crd.Name, Message: fmt.Sprintf("serves deprecated version %s", v.Name)}
+			if v.Name == storage {
+				f.Severity, f.Message = "medium", fmt.Sprintf("stores its instances in deprecated version %s", v.Name)
+			}
+			if v.DeprecationWarning != nil {
+				f.Message += ": " + *v.DeprecationWarning
+			}
+			findings = append(findings, f)
+		}
+
+		for _, stored := range crd.Status.StoredVersions {
+			if stored == storage {
+				continue
+			}
+			f := auditFinding{Severity: "medium", Check: "stored-version-drift", CRD: crd.Name,
+				Message: fmt.Sprintf("status.storedVersions still lists %s besides storage version %s: migrate the objects stored in it before removing the version", stored, storage)}
+			if !served[stored] {
+				f.Severity = "high"
+				f.Message = fmt.Sprintf("status.storedVersions lists %s, which is no longer served: objects still stored in it cannot be read until it is served and they are migrated", stored)
+			}
+			findings = append(findings, f)
+		}
+
+		if counts[crd.Name] == 0 && !failed[crd.Name] {
+			findings = append(findings, auditFinding{Severity: "low", Check: "empty-crd", CRD: crd.Name, Message: "no instances " + scope})
+		}
+	}
+	return findings
+}
+
+// ownerChecker finds instances whose owner references point at objects that are gone,
+// which the garbage collector should have deleted with them.
+type ownerChecker struct {
+	s *scan.Scanner
+
+	// scanned maps the objectKey of every scanned instance to its UID, so owners that are
+	// custom resources need no API call
+	scanned map[string]string
+	// resources caches the API resources of each owner apiVersion; nil when unknown
+	resources map[string][]metav1.APIResource
+	// owners caches the UID of each owner looked up, or "" when it does not exist
+	owners map[string]string
+}
+
+// orphanFindings reports the instances in results with a missing owner.
+func (c *ownerChecker) orphanFindings(ctx context.Context, results []scan.Result) ([]auditFinding, error) {
+	c.scanned = map[string]string{}
+	for _, res := range results {
+		c.scanned[objectKey(res.GVR.Group, res.Kind, res.Namespace, res.InstanceName)] = res.UID
+	}
+	c.resources = map[string][]metav1.APIResource{}
+	c.owners = map[string]string{}
+
+	var findings []auditFinding
+	for i := range results {
+		res := &results[i]
+		obj, err := res.LoadObject()
+		if err != nil {
+			return nil, err
+		}
+		for _, owner := range obj.GetOwnerReferences() {
+			if message := c.missingOwner(ctx, res.Namespace, owner); message != "" {
+				findings = append(findings, auditFinding{Severity: "medium", Check: "orphan", CRD: res.CRDName, Namespace: res.Namespace, Name: res.InstanceName, Message: message})
+			}
+		}
+	}
+	return findings, nil
+}
+
+// missingOwner describes why owner, referenced from an instance in namespace, is missing,
+// or returns "" if it exists or cannot be checked.
+func (c *ownerChecker) missingOwner(ctx context.Context, namespace string, owner metav1.OwnerReference) string {
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return ""
+	}
+	uid, found := c.scanned[objectKey(gv.Group, owner.Kind, namespace, owner.Name)]
+	if found {
+		// Scanned instances exist, though offline ones may have no UID to compare
+		if uid == "" {
+			return ""
+		}
+	} else if uid, found = c.lookup(ctx, gv, namespace, owner); !found {
+		return ""
+	}
+	switch {
+	case uid == "":
+		return fmt.Sprintf("owner %s %s no longer exists", owner.Kind, owner.Name)
+	case owner.UID != "" && string(owner.UID) != uid:
+		return fmt.Sprintf("owner %s %s was deleted and recreated with another UID", owner.Kind, owner.Name)
+	}
+	return ""
+}
+
+// ownerResource returns the resource name of kind in gv and whether it is namespaced,
+// from the scanned CRDs or else the discovery API; ok is false if it cannot be found.
+func (c *ownerChecker) ownerResource(gv schema.GroupVersion, kind string) (resource string, namespaced, ok bool) {
+	for _, crd := range c.s.CRDs {
+		if crd.Spec.Group == gv.Group && crd.Spec.Names.Kind == kind {
+			return crd.Spec.Names.Plural, crd.Spec.Scope == apiextensionsv1.NamespaceScoped, true
+		}
+	}
+	apiVersion := gv.String()
+	resources, cached := c.resources[apiVersion]
+	if !cached {
+		client := c.s.DiscoveryClient
+		if client == nil {
+			client = c.s.APIExtensionsClient.Discovery()
+		}
+		list, err := client.ServerResourcesForGroupVersion(apiVersion)
+		if err != nil {
+			slog.Debug("cannot resolve owner kinds", "apiVersion", apiVersion, "error", err)
+		} else {
+			resources = list.APIResources
+		}
+		c.resources[apiVersion] = resources
+	}
+	for _, r := range resources {
+		if r.Kind == kind && !strings.Contains(r.Name, "/") {
+			return r.Name, r.Namespaced, true
+		}
+	}
+	return "", false, false
+}
+
+// lookup gets owner from the API server and returns its UID, or "" if it does not exist.
+// found is false when the owner's kind is unknown or the call fails for another reason.
+func (c *ownerChecker) lookup(ctx context.Context, gv schema.GroupVersion, namespace string, owner metav1.OwnerReference) (uid string, found bool) {
+	resource, namespaced, ok := c.ownerResource(gv, owner.Kind)
+	if !ok {
+		return "", false
+	}
+	if !namespaced {
+		namespace = ""
+	}
+
+	key := objectKey(gv.Group, owner.Kind, namespace, owner.Name)
+	if uid, ok := c.owners[key]; ok {
+		return uid, true
+	}
+	obj, err := c.s.DynamicClient.Resource(gv.WithResource(resource)).Namespace(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		c.owners[key] = ""
+		return "", true
+	case err != nil:
+		slog.Debug("cannot get owner", "kind", owner.Kind, "namespace", namespace, "name", owner.Name, "error", err)
+		return "", false
+	}
+	c.owners[key] = string(obj.GetUID())
+	return c.owners[key], true
+}
+
+// instanceFindings reports instances stuck in deletion, instances at or above the
+// -size-warning threshold and instances whose reconciliation is paused.
+func instanceFindings(results []scan.Result, sizeWarning int, now time.Time) ([]auditFinding, error) {
+	var findings []auditFinding
+	for i := range results {
+		res := &results[i]
+		obj, err := res.LoadObject()
+		if err != nil {
+			return nil, err
+		}
+		if res.StuckDeleting {
+			message := fmt.Sprintf("deleted %s ago", duration.HumanDuration(now.Sub(obj.GetDeletionTimestamp().Time)))
+			if finalizers := obj.GetFinalizers(); len(finalizers) > 0 {
+				message += ", waiting on finalizers " + strings.Join(finalizers, ", ")
+			}
+			findings = append(findings, auditFinding{Severity: "high", Check: "stuck-deletion", CRD: res.CRDName, Namespace: res.Namespace, Name: res.InstanceName, Message: message})
+		}
+		if sizeWarning > 0 && res.Size >= sizeWarning {
+			findings = append(findings, auditFinding{Severity: "medium", Check: "near-size-limit", CRD: res.CRDName, Namespace: res.Namespace, Name: res.InstanceName,
+				Message: fmt.Sprintf("serialized size %s is close to the API server's ~1.5MiB request limit", output.FormatSize(res.Size, 0))})
+		}
+		if by := scan.SuspendedBy(obj); by != "" {
+			findings = append(findings, auditFinding{Severity: "low", Check: "suspended", CRD: res.CRDName, Namespace: res.Namespace, Name: res.InstanceName,
+				Message: "reconciliation is paused by " + by + ": resume it once the pause is no longer needed"})
+		}
+	}
+	return findings, nil
+}
+
+// collisionFindings reports each CRD sharing its Kind or resource name with CRDs in other
+// API groups.
+func collisionFindings(collisions []scan.Collision) []auditFinding {
+	// A CRD usually shares both its Kind and its resource name, which make one finding
+	shared := map[string][]string{}
+	others := map[string][]string{}
+	for _, c := range collisions {
+		for _, crd := range c.CRDs {
+			shared[crd] = append(shared[crd], c.Field+" "+c.Name)
+			for _, other := range c.CRDs {
+				if other != crd && !slices.Contains(others[crd], other) {
+					others[crd] = append(others[crd], other)
+				}
+			}
+		}
+	}
+	var findings []auditFinding
+	for crd, names := range shared {
+		findings = append(findings, auditFinding{Severity: "low", Check: "name-collision", CRD: crd,
+			Message: fmt.Sprintf("shares %s with %s, so kubectl and scripts using the short name may get the wrong one", strings.Join(names, " and "), strings.Join(others[crd], ", "))})
+	}
+	return findings
+}
+
+// scanFindings reports the resource types the scan could not list, as RBAC gaps when
+// access was denied, and the other problems the scan ran into.
+func scanFindings(stats *scan.Stats) []auditFinding {
+	var findings []auditFinding
+	for _, p := range stats.ListFailures {
+		if p.Reason == string(metav1.StatusReasonForbidden) || p.Reason == string(metav1.StatusReasonUnauthorized) {
+			findings = append(findings, auditFinding{Severity: "high", Check: "rbac-gap", CRD: p.CRD, Message: "cannot list instances, so none were audited: " + p.Message})
+			continue
+		}
+		findings = append(findings, auditFinding{Severity: "medium", Check: "scan-problem", CRD: p.CRD, Message: "listing failed: " + p.Message})
+	}
+	for _, p := range stats.Problems {
+		findings = append(findings, auditFinding{Severity: "medium", Check: "scan-problem", CRD: p.CRD, Message: p.Message})
+	}
+	return findings
+}
+
+// sortFindings orders findings by severity, then by check, CRD, namespace and name.
+func sortFindings(findings []auditFinding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return slices.Index(auditSeverities, a.Severity) < slices.Index(auditSeverities, b.Severity)
+		}
+		if a.Check != b.Check {
+			return a.Check < b.Check
+		}
+		if a.CRD != b.CRD {
+			return a.CRD < b.CRD
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+}
+
+// runAudit implements `kgcr audit`: one scan, every check, and a single report of the
+// findings ranked by severity.
+func runAudit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	format := fs.String("o", "table", "report format: table or json")
+	failOn := fs.String("fail-on", "", "exit with status 1 if any finding is at least this severe: high, medium or low")
+	sf.Parse(fs, args)
+	if *format != "table" && *format != "json" {
+		fatal(fmt.Errorf("invalid -o %q: must be table or json", *format))
+	}
+	if *failOn != "" && !slices.Contains(auditSeverities, *failOn) {
+		fatal(fmt.Errorf("invalid -fail-on %q: must be high, medium or low", *failOn))
+	}
+	// An audit covers the whole cluster unless -n narrows it
+	if sf.Namespace == "" {
+		sf.AllNamespaces = true
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.KeepObjects = true
+	s.ComputeSize = true
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+
+	counts := map[string]int{}
+	for _, res := range allResults {
+		counts[res.CRDName]++
+	}
+	failed := map[string]bool{}
+	for _, p := range s.Stats.ListFailures {
+		failed[p.CRD] = true
+	}
+	scope := "in any namespace"
+	if !s.AllNamespaces {
+		scope = "in namespace " + s.Namespace
+	}
+
+	findings := scanFindings(&s.Stats)
+	findings = append(findings, crdFindings(s.CRDs, counts, failed, scope)...)
+	findings = append(findings, collisionFindings(s.Collisions)...)
+	more, err := instanceFindings(allResults, s.SizeWarning, time.Now())
+	if err != nil {
+		fatal(err)
+	}
+	findings = append(findings, more...)
+	checker := &ownerChecker{s: s}
+	more, err = checker.orphanFindings(ctx, allResults)
+	if err != nil {
+		fatal(err)
+	}
+	findings = append(findings, more...)
+	sortFindings(findings)
+
+	summary := map[string]int{}
+	for _, severity := range auditSeverities {
+		summary[severity] = 0
+	}
+	for _, f := range findings {
+		summary[f.Severity]++
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		report := struct {
+			Summary  map[string]int `json:"summary"`
+			Findings []auditFinding `json:"findings"`
+		}{summary, findings}
+		if report.Findings == nil {
+			report.Findings = []auditFinding{}
+		}
+		if err := enc.Encode(report); err != nil {
+			fatal(err)
+		}
+	} else if len(findings) > 0 {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		if !sf.Quiet {
+			fmt.Fprintln(w, "SEVERITY\tCHECK\tCRD\tNAMESPACE\tNAME\tMESSAGE")
+		}
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", strings.ToUpper(f.Severity), f.Check, f.CRD, f.Namespace, f.Name, f.Message)
+		}
+		w.Flush()
+		say(&sf, os.Stderr, "Findings: %d high, %d medium, %d low\n", summary["high"], summary["medium"], summary["low"])
+	} else {
+		say(&sf, os.Stderr, "No findings in %d custom resources of %d CRDs\n", len(allResults), len(s.CRDs))
+	}
+
+	if *failOn != "" {
+		threshold := slices.Index(auditSeverities, *failOn)
+		for _, severity := range auditSeverities[:threshold+1] {
+			if summary[severity] > 0 {
+				os.Exit(1)
+			}
+		}
+	}
+}
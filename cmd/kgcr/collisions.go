@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// runCollisions implements `kgcr collisions`: list the Kinds and resource names shared by
+// CRDs in different API groups, which kubectl resolves to just one of them. It exits with
+// status 1 when there are any.
+func runCollisions(args []string) {
+	fs := flag.NewFlagSet("collisions", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	format := fs.String("o", "table", "output format: table or json")
+	sf.Parse(fs, args)
+	if *format != "table" && *format != "json" {
+		fatal(fmt.Errorf("invalid -o %q: must be table or json", *format))
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	// Only the CRDs are needed, not their instances
+	crds, err := s.ListCRDs(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	collisions := scan.FindCollisions(crds)
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if collisions == nil {
+			collisions = []scan.Collision{}
+		}
+		if err := enc.Encode(collisions); err != nil {
+			fatal(err)
+		}
+	} else if len(collisions) > 0 {
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		if !sf.Quiet {
+			fmt.Fprintln(w, "FIELD\tNAME\tCRDS")
+		}
+		for _, c := range collisions {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Field, c.Name, strings.Join(c.CRDs, ", "))
+		}
+		w.Flush()
+		say(&sf, os.Stderr, "Pick one with -by-kind <Kind>.<group>, or in kubectl with <resource>.<group>\n")
+	} else {
+		say(&sf, os.Stderr, "No Kind or resource name is shared across API groups by the %d CRDs\n", len(crds))
+	}
+
+	if len(collisions) > 0 {
+		os.Exit(1)
+	}
+}
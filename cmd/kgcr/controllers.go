@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// crdActivity aggregates the managedFields of every instance of one CRD.
+type crdActivity struct {
+	instances        int
+	withStatus       int // instances with at least one status manager
+	statusManagers   map[string]int
+	specManagers     map[string]int
+	lastStatusUpdate time.Time
+}
+
+// writesStatus reports whether a managedFields entry owns fields under .status, either
+// through the status subresource or a main-resource write that includes status.
+func writesStatus(entry metav1.ManagedFieldsEntry) bool {
+	if entry.Subresource == "status" {
+		return true
+	}
+	return entry.FieldsV1 != nil && strings.Contains(string(entry.FieldsV1.Raw), `"f:status"`)
+}
+
+// record adds one instance's managedFields to the aggregate.
+func (a *crdActivity) record(entries []metav1.ManagedFieldsEntry) {
+	a.instances++
+	hasStatus := false
+	for _, entry := range entries {
+		if writesStatus(entry) {
+			hasStatus = true
+			a.statusManagers[entry.Manager]++
+			if entry.Time != nil && entry.Time.After(a.lastStatusUpdate) {
+				a.lastStatusUpdate = entry.Time.Time
+			}
+		}
+		if entry.Subresource == "" && entry.FieldsV1 != nil && strings.Contains(string(entry.FieldsV1.Raw), `"f:spec"`) {
+			a.specManagers[entry.Manager]++
+		}
+	}
+	if hasStatus {
+		a.withStatus++
+	}
+}
+
+// managerList renders managers as "name(count)", most active first.
+func managerList(managers map[string]int) string {
+	if len(managers) == 0 {
+		return "<none>"
+	}
+	names := make([]string, 0, len(managers))
+	for name := range managers {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if managers[names[i]] != managers[names[j]] {
+			return managers[names[i]] > managers[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s(%d)", name, managers[name])
+	}
+	return strings.Join(names, ",")
+}
+
+// runControllers implements `kgcr controllers`: aggregate managedFields across all custom
+// resources and report, per CRD, which managers write status and spec. CRDs whose instances
+// have no status writer often belong to an operator that is gone.
+func runControllers(args []string) {
+	fs := flag.NewFlagSet("controllers", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	sf.Parse(fs, args)
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.KeepObjects = true
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+	if len(allResults) == 0 {
+		say(&sf, os.Stderr, "No custom resources found\n")
+		return
+	}
+
+	// Results are sorted by CRD name, so activity is built in output order
+	var crdNames []string
+	activity := map[string]*crdActivity{}
+	for _, res := range allResults {
+		a := activity[res.CRDName]
+		if a == nil {
+			a = &crdActivity{statusManagers: map[string]int{}, specManagers: map[string]int{}}
+			activity[res.CRDName] = a
+			crdNames = append(crdNames, res.CRDName)
+		}
+		obj, err := res.LoadObject()
+		if err != nil {
+			fatal(err)
+		}
+		a.record(obj.GetManagedFields())
+	}
+
+	now := time.Now()
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	if !sf.Quiet {
+		fmt.Fprintln(w, "CRD\tINSTANCES\tWITH STATUS\tLAST STATUS UPDATE\tSTATUS MANAGERS\tSPEC MANAGERS")
+	}
+	for _, name := range crdNames {
+		a := activity[name]
+		lastUpdate := "<never>"
+		if !a.lastStatusUpdate.IsZero() {
+			lastUpdate = duration.HumanDuration(now.Sub(a.lastStatusUpdate)) + " ago"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", name, a.instances, a.withStatus, lastUpdate, managerList(a.statusManagers), managerList(a.specManagers))
+	}
+	w.Flush()
+}
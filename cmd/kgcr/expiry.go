@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/duration"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// expiryTime returns when obj expires according to the first of annotations it carries.
+// A value is either an absolute RFC3339 timestamp (kgcr.io/expires-at: 2025-01-31T00:00:00Z)
+// or a TTL relative to the creation timestamp in the kube-janitor style (janitor/ttl: 7d).
+func expiryTime(obj *unstructured.Unstructured, annotations []string) (time.Time, string, error) {
+	values := obj.GetAnnotations()
+	for _, key := range annotations {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, key, nil
+		}
+		ttl, err := parseTTL(value)
+		if err != nil {
+			return time.Time{}, key, fmt.Errorf("invalid %s annotation %q: must be an RFC3339 timestamp or a duration like 24h or 7d", key, value)
+		}
+		return obj.GetCreationTimestamp().Add(ttl), key, nil
+	}
+	return time.Time{}, "", nil
+}
+
+// parseTTL parses a Go duration, additionally accepting the d (day) and w (week) units.
+func parseTTL(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+// runExpired implements `kgcr expired`: report custom resources past the expiry set in an
+// annotation and, with -delete-expired, delete them.
+func runExpired(args []string) {
+	fs := flag.NewFlagSet("expired", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	annotations := fs.String("annotation", "kgcr.io/expires-at,janitor/ttl,janitor/expires", "comma-separated expiry annotations, checked in order. Values are RFC3339 timestamps or TTLs like 24h or 7d")
+	deleteExpired := fs.Bool("delete-expired", false, "delete the custom resources that are past their expiry")
+	dryRun := fs.Bool("dry-run", false, "with -delete-expired, only submit server-side dry-run deletes")
+	sf.Parse(fs, args)
+	if *dryRun && !*deleteExpired {
+		fatal(errors.New("-dry-run only applies to -delete-expired"))
+	}
+	if *deleteExpired && sf.Offline() {
+		fatal(errors.New("-delete-expired needs a cluster and cannot be used with -from-dir or -from-dump"))
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.KeepObjects = true
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+
+	keys := strings.Split(*annotations, ",")
+	now := time.Now()
+
+	// The scan may have used up most of -timeout, so the deletes get a deadline of their own.
+	deleteCtx, cancelDelete := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancelDelete()
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	expired := 0
+	for _, res := range allResults {
+		obj, err := res.LoadObject()
+		if err != nil {
+			fatal(err)
+		}
+		expiresAt, key, err := expiryTime(obj, keys)
+		if err != nil {
+			slog.Warn("skipping instance with an invalid expiry", "namespace", res.Namespace, "crd", res.CRDName, "name", res.InstanceName, "error", err)
+			continue
+		}
+		if key == "" || expiresAt.After(now) {
+			continue
+		}
+
+		status := ""
+		if *deleteExpired {
+			status = "deleted"
+			// Only delete the object that was scanned: one recreated under the same name since
+			// then has a new UID, and one updated since then a new resourceVersion.
+			uid, rv := obj.GetUID(), obj.GetResourceVersion()
+			opts := metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid, ResourceVersion: &rv}}
+			if *dryRun {
+				opts.DryRun = []string{metav1.DryRunAll}
+				status = "deleted (dry run)"
+			}
+			err := s.DynamicClient.Resource(res.GVR).Namespace(res.Namespace).Delete(deleteCtx, res.InstanceName, opts)
+			switch {
+			case apierrors.IsConflict(err):
+				status = "changed since scan, skipped"
+			case err != nil:
+				status = "delete failed: " + err.Error()
+			}
+		}
+
+		if expired == 0 && !sf.Quiet {
+			header := "NAMESPACE\tCRD\tNAME\tANNOTATION\tEXPIRED"
+			if *deleteExpired {
+				header += "\tSTATUS"
+			}
+			fmt.Fprintln(w, header)
+		}
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s ago", res.Namespace, res.CRDName, res.InstanceName, key, duration.HumanDuration(now.Sub(expiresAt)))
+		if *deleteExpired {
+			row += "\t" + status
+		}
+		fmt.Fprintln(w, row)
+		expired++
+	}
+	w.Flush()
+
+	if expired == 0 {
+		say(&sf, os.Stderr, "No expired custom resources found in %d custom resources\n", len(allResults))
+	}
+}
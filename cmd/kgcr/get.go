@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+
+	"kgcr/internal/config"
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// matchName returns the results whose instance name contains partial, case-insensitively.
+// If any name matches exactly, only those are returned.
+func matchName(results []scan.Result, partial string) []scan.Result {
+	partial = strings.ToLower(partial)
+	var matches, exact []scan.Result
+	for _, res := range results {
+		name := strings.ToLower(res.InstanceName)
+		if name == partial {
+			exact = append(exact, res)
+		}
+		if strings.Contains(name, partial) {
+			matches = append(matches, res)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return matches
+}
+
+// chooseMatch lists matches on out and reads the user's choice from in: a number, or "all".
+func chooseMatch(in io.Reader, out io.Writer, matches []scan.Result) ([]scan.Result, error) {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "#\tNAMESPACE\tCRD\tNAME")
+	for i, res := range matches {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, res.Namespace, res.CRDName, res.InstanceName)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "Select a custom resource [1-%d, all]: ", len(matches))
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("reading selection: %w", err)
+	}
+	line = strings.TrimSpace(line)
+	if line == "all" {
+		return matches, nil
+	}
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 || n > len(matches) {
+		return nil, fmt.Errorf("invalid selection %q", line)
+	}
+	return matches[n-1 : n], nil
+}
+
+// runGet implements `kgcr get`: find instances by partial name across all CRDs and print
+// their full YAML. When several match, it prompts for one on a terminal and otherwise lists
+// the matches and exits with status 1.
+func runGet(args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kgcr get [flags] <partial-name>\n")
+		fs.PrintDefaults()
+	}
+	var sf config.Flags
+	sf.Register(fs)
+	clean := fs.Bool("clean", false, "strip managedFields, status, resourceVersion, uid and creationTimestamp so the output can be re-applied")
+	positional := sf.Parse(fs, args)
+
+	if len(positional) != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	// Only the instances that can match are kept, rather than every object in the cluster
+	s.KeepObjects = true
+	s.Filters = append(s.Filters, scan.NewNameFilter(positional[0]))
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+
+	matches := matchName(allResults, positional[0])
+	switch {
+	case len(matches) == 0:
+		say(&sf, os.Stderr, "No custom resources match %q\n", positional[0])
+		os.Exit(1)
+	case len(matches) > 1 && output.IsTerminal(os.Stdin):
+		matches, err = chooseMatch(os.Stdin, os.Stderr, matches)
+		if err != nil {
+			fatal(err)
+		}
+	case len(matches) > 1:
+		say(&sf, os.Stderr, "%d custom resources match %q:\n", len(matches), positional[0])
+		output.PrintNames(os.Stderr, matches)
+		os.Exit(1)
+	}
+
+	for i := range matches {
+		obj, err := output.ExportObject(&matches[i], *clean)
+		if err != nil {
+			fatal(err)
+		}
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			fatal(err)
+		}
+		if i > 0 {
+			fmt.Println("---")
+		}
+		os.Stdout.Write(data)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// graphNode is a box in `kgcr graph`: a scanned custom resource, an owner that was not
+// scanned, or a Secret or ConfigMap a custom resource references.
+type graphNode struct {
+	id        string // n0, n1, ... valid in both DOT and Mermaid
+	kind      string
+	namespace string
+	name      string
+	external  bool // not a scanned custom resource
+}
+
+// graphEdge points from an owner to what it owns, or from a custom resource to a Secret or
+// ConfigMap it references, labelled with the field holding the reference.
+type graphEdge struct {
+	from, to *graphNode
+	label    string
+	ref      bool
+}
+
+// resourceGraph collects the nodes and edges of `kgcr graph`.
+type resourceGraph struct {
+	nodes []*graphNode
+	byKey map[string]*graphNode
+	edges []graphEdge
+}
+
+// node returns the node for key, adding it if it is new.
+func (g *resourceGraph) node(key, kind, namespace, name string, external bool) *graphNode {
+	if n, ok := g.byKey[key]; ok {
+		return n
+	}
+	n := &graphNode{id: fmt.Sprintf("n%d", len(g.nodes)), kind: kind, namespace: namespace, name: name, external: external}
+	g.nodes = append(g.nodes, n)
+	g.byKey[key] = n
+	return n
+}
+
+// objectKey identifies an object by API group, kind, namespace and name, so owner
+// references match scanned objects even offline, where UIDs may be missing.
+func objectKey(group, kind, namespace, name string) string {
+	return group + "/" + kind + "/" + namespace + "/" + name
+}
+
+// buildGraph adds a node per result, an edge from each owner reference and, with refs, an
+// edge to each Secret and ConfigMap found in the spec.
+func buildGraph(results []scan.Result, refs bool) (*resourceGraph, error) {
+	g := &resourceGraph{byKey: map[string]*graphNode{}}
+	objects := make([]*unstructured.Unstructured, len(results))
+	for i := range results {
+		res := &results[i]
+		obj, err := res.LoadObject()
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = obj
+		g.node(objectKey(res.GVR.Group, res.Kind, res.Namespace, res.InstanceName), res.Kind, res.Namespace, res.InstanceName, false)
+	}
+
+	for i := range results {
+		res := &results[i]
+		owned := g.byKey[objectKey(res.GVR.Group, res.Kind, res.Namespace, res.InstanceName)]
+		for _, owner := range objects[i].GetOwnerReferences() {
+			gv, _ := schema.ParseGroupVersion(owner.APIVersion)
+			// Owners live in the namespace of what they own or are cluster-scoped
+			key := objectKey(gv.Group, owner.Kind, res.Namespace, owner.Name)
+			if _, ok := g.byKey[key]; !ok {
+				if clusterKey := objectKey(gv.Group, owner.Kind, "", owner.Name); g.byKey[clusterKey] != nil {
+					key = clusterKey
+				}
+			}
+			from := g.node(key, owner.Kind, "", owner.Name, true)
+			g.edges = append(g.edges, graphEdge{from: from, to: owned, label: "owns"})
+		}
+		if !refs {
+			continue
+		}
+		spec, ok := objects[i].Object["spec"]
+		if !ok {
+			continue
+		}
+		for _, ref := range specRefs(spec, "spec", nil) {
+			to := g.node(objectKey("", ref.kind, res.Namespace, ref.name), ref.kind, res.Namespace, ref.name, true)
+			g.edges = append(g.edges, graphEdge{from: owned, to: to, label: ref.path, ref: true})
+		}
+	}
+	return g, nil
+}
+
+// connected drops the nodes without any edge.
+func (g *resourceGraph) connected() {
+	linked := map[*graphNode]bool{}
+	for _, e := range g.edges {
+		linked[e.from], linked[e.to] = true, true
+	}
+	nodes := g.nodes[:0]
+	for _, n := range g.nodes {
+		if linked[n] {
+			nodes = append(nodes, n)
+		}
+	}
+	g.nodes = nodes
+}
+
+// specRef is a Secret or ConfigMap named in a custom resource's spec.
+type specRef struct {
+	kind, name, path string
+}
+
+// graphRefKinds are the kinds `kgcr graph -refs` draws, by the keyword that marks a field
+// as pointing at them, as in `kgcr refs`.
+var graphRefKinds = map[string]string{"secret": "Secret", "configmap": "ConfigMap"}
+
+// specRefs returns the Secrets and ConfigMaps referenced under node, found like `kgcr refs`
+// finds them: an object reference with a matching kind, or a field whose name mentions the
+// kind (secretName, configMapRef, ...) holding a name or an object with a name.
+func specRefs(node interface{}, path string, found []specRef) []specRef {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if kind, ok := node["kind"].(string); ok {
+			if name, ok := node["name"].(string); ok && graphRefKinds[strings.ToLower(kind)] != "" {
+				found = append(found, specRef{kind: graphRefKinds[strings.ToLower(kind)], name: name, path: path})
+			}
+		}
+		keys := make([]string, 0, len(node))
+		for key := range node {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, child := node[key], path+"."+key
+			if kind := refKindOf(key); kind != "" {
+				if name, ok := value.(string); ok && name != "" && (strings.HasSuffix(strings.ToLower(key), "name") || strings.HasSuffix(strings.ToLower(key), kind)) {
+					found = append(found, specRef{kind: graphRefKinds[kind], name: name, path: child})
+					continue
+				}
+				if m, ok := value.(map[string]interface{}); ok {
+					if name, ok := m["name"].(string); ok && name != "" {
+						found = append(found, specRef{kind: graphRefKinds[kind], name: name, path: child})
+						continue
+					}
+				}
+			}
+			found = specRefs(value, child, found)
+		}
+	case []interface{}:
+		for i, value := range node {
+			found = specRefs(value, fmt.Sprintf("%s[%d]", path, i), found)
+		}
+	}
+	return found
+}
+
+// refKindOf returns the keyword of the kind a field name mentions, or "".
+func refKindOf(key string) string {
+	key = strings.ToLower(key)
+	for keyword := range graphRefKinds {
+		if strings.Contains(key, keyword) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// writeDOT renders g in Graphviz DOT, with a cluster per namespace.
+func (g *resourceGraph) writeDOT(w io.Writer) {
+	fmt.Fprintln(w, "digraph kgcr {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, `  node [shape=box, fontname="Helvetica"];`)
+	fmt.Fprintln(w, `  edge [fontname="Helvetica", fontsize=10];`)
+	for i, ns := range g.namespaces() {
+		indent := "  "
+		if ns != "" {
+			fmt.Fprintf(w, "  subgraph cluster_%d {\n    label=%s;\n", i, dotQuote(ns))
+			indent = "    "
+		}
+		for _, n := range g.nodes {
+			if n.namespace != ns {
+				continue
+			}
+			style := ""
+			if n.external {
+				style = ", style=dashed"
+			}
+			fmt.Fprintf(w, "%s%s [label=%s%s];\n", indent, n.id, dotQuote(n.kind+"\n"+n.name), style)
+		}
+		if ns != "" {
+			fmt.Fprintln(w, "  }")
+		}
+	}
+	for _, e := range g.edges {
+		style := ""
+		if e.ref {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "  %s -> %s [label=%s%s];\n", e.from.id, e.to.id, dotQuote(e.label), style)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// writeMermaid renders g as a Mermaid flowchart, with a subgraph per namespace.
+func (g *resourceGraph) writeMermaid(w io.Writer) {
+	fmt.Fprintln(w, "flowchart LR")
+	for i, ns := range g.namespaces() {
+		indent := "  "
+		if ns != "" {
+			fmt.Fprintf(w, "  subgraph ns%d[%s]\n", i, mermaidQuote(ns))
+			indent = "    "
+		}
+		for _, n := range g.nodes {
+			if n.namespace != ns {
+				continue
+			}
+			label := mermaidQuote(n.kind + "<br/>" + n.name)
+			if n.external {
+				// Rounded boxes for objects that were not scanned
+				fmt.Fprintf(w, "%s%s(%s)\n", indent, n.id, label)
+			} else {
+				fmt.Fprintf(w, "%s%s[%s]\n", indent, n.id, label)
+			}
+		}
+		if ns != "" {
+			fmt.Fprintln(w, "  end")
+		}
+	}
+	for _, e := range g.edges {
+		arrow := "-->"
+		if e.ref {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(w, "  %s %s|%s| %s\n", e.from.id, arrow, mermaidQuote(e.label), e.to.id)
+	}
+}
+
+// namespaces returns the namespaces of g's nodes, sorted, with "" for cluster-scoped and
+// unplaced nodes first.
+func (g *resourceGraph) namespaces() []string {
+	seen := map[string]bool{"": true}
+	namespaces := []string{""}
+	for _, n := range g.nodes {
+		if !seen[n.namespace] {
+			seen[n.namespace] = true
+			namespaces = append(namespaces, n.namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+// runGraph implements `kgcr graph`: a Graphviz or Mermaid diagram of custom resources and
+// their owner references, and optionally the Secrets and ConfigMaps they reference.
+func runGraph(args []string) {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	format := fs.String("o", "dot", "diagram format: dot (Graphviz) or mermaid")
+	refs := fs.Bool("refs", false, "also draw the Secrets and ConfigMaps referenced from each custom resource's spec")
+	connectedOnly := fs.Bool("connected", false, "leave out custom resources without any owner or reference")
+	sf.Parse(fs, args)
+	if *format != "dot" && *format != "mermaid" {
+		fatal(fmt.Errorf("invalid -o %q: must be dot or mermaid", *format))
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.KeepObjects = true
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+
+	g, err := buildGraph(allResults, *refs)
+	if err != nil {
+		fatal(err)
+	}
+	if *connectedOnly {
+		g.connected()
+	}
+	if *format == "mermaid" {
+		g.writeMermaid(os.Stdout)
+	} else {
+		g.writeDOT(os.Stdout)
+	}
+}
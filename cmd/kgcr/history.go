@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"kgcr/internal/config"
+	"kgcr/internal/history"
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// formatChange renders the change from one count to another with its percentage, e.g.
+// "+12 (+40%)", or "new" for a CRD that had no instances before.
+func formatChange(from, to int) string {
+	switch {
+	case from == to:
+		return "0"
+	case from == 0:
+		return "new"
+	}
+	return fmt.Sprintf("%+d (%+.0f%%)", to-from, float64(to-from)*100/float64(from))
+}
+
+// formatSizeChange renders a change in bytes with binary units, e.g. "+1.5MiB".
+func formatSizeChange(from, to int64) string {
+	switch {
+	case from == to:
+		return "0"
+	case to > from:
+		return "+" + output.FormatSize(int(to-from), 0)
+	}
+	return "-" + output.FormatSize(int(from-to), 0)
+}
+
+// historyNarrowingFlags are the scan flags that leave CRDs or instances out of the counts.
+var historyNarrowingFlags = []string{
+	"limit-per-crd", "namespace-regex", "annotation", "has-annotation", "suspended-only", "near-limit",
+	"cel", "jq", "by-kind", "category", "crd-selector", "operator",
+}
+
+// runHistory implements `kgcr history`: with -record, scan and store each CRD's instance
+// count and size in a local database; then show how they changed over -since, for
+// capacity planning of etcd.
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	record := fs.Bool("record", false, "scan and record each CRD's instance count and size before showing the trends; run it periodically, e.g. from cron")
+	since := fs.String("since", "30d", "compare the first scan recorded in this period with the latest, as a duration like 720h, 30d or 4w")
+	store := fs.String("store", "", "history database file (default $XDG_DATA_HOME/kgcr/history.db or ~/.local/share/kgcr/history.db, %LOCALAPPDATA%\\kgcr\\history.db on Windows)")
+	format := fs.String("o", "table", "output format: table or json")
+	sf.Parse(fs, args)
+	if *format != "table" && *format != "json" {
+		fatal(fmt.Errorf("invalid -o %q: must be table or json", *format))
+	}
+	period, err := parseTTL(*since)
+	if err != nil || period <= 0 {
+		fatal(fmt.Errorf("invalid -since %q: must be a duration like 720h, 30d or 4w", *since))
+	}
+	if *store == "" {
+		if *store, err = history.DefaultPath(); err != nil {
+			fatal(err)
+		}
+	}
+	if *record {
+		// Records are keyed by cluster and namespace only, so a scan narrowed by a filter
+		// would be compared with full ones and show as a drop that never happened.
+		fs.Visit(func(f *flag.Flag) {
+			if slices.Contains(historyNarrowingFlags, f.Name) {
+				fatal(fmt.Errorf("-record needs full counts and cannot be used with -%s", f.Name))
+			}
+		})
+	}
+	// History tracks the whole cluster unless -n narrows it
+	if sf.Namespace == "" {
+		sf.AllNamespaces = true
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	st, err := history.Open(*store)
+	if err != nil {
+		fatal(err)
+	}
+	defer st.Close()
+
+	if *record {
+		s.ComputeSize = true
+
+		// Create context with timeout
+		ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+		defer cancel()
+
+		allResults, err := s.Scan(ctx)
+		if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+			fatal(err)
+		}
+		// A CRD that could not be listed would be recorded as emptied out, and show as a
+		// drop and later a regrowth that never happened, so such a scan is not recorded.
+		if len(s.Stats.ListFailures) > 0 {
+			for _, p := range s.Stats.ListFailures {
+				slog.Error("listing failed", "crd", p.CRD, "error", p.Message)
+			}
+			fatal(fmt.Errorf("not recording a scan in which %d CRDs could not be listed", len(s.Stats.ListFailures)))
+		}
+		counts := map[string]history.Count{}
+		for _, crd := range s.CRDs {
+			counts[crd.Name] = history.Count{}
+		}
+		for _, res := range allResults {
+			c := counts[res.CRDName]
+			c.Instances++
+			c.Bytes += int64(res.Size)
+			counts[res.CRDName] = c
+		}
+		if err := st.Record(time.Now(), s.Cluster, s.Namespace, counts); err != nil {
+			fatal(err)
+		}
+		say(&sf, os.Stderr, "Recorded %d custom resources of %d CRDs in %s\n", len(allResults), len(counts), *store)
+	}
+
+	trends, compared, err := st.Trends(s.Cluster, s.Namespace, time.Now().Add(-period))
+	if errors.Is(err, history.ErrNoScans) {
+		fatal(fmt.Errorf("no scans of %s recorded in the last %s in %s; record one with kgcr history -record", s.Cluster, *since, *store))
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		report := struct {
+			Cluster   string          `json:"cluster"`
+			Namespace string          `json:"namespace,omitempty"`
+			Period    history.Period  `json:"period"`
+			Trends    []history.Trend `json:"trends"`
+		}{s.Cluster, s.Namespace, compared, trends}
+		if err := enc.Encode(report); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	say(&sf, os.Stderr, "Comparing %d scans of %s from %s to %s\n", compared.Scans, s.Cluster,
+		compared.From.Local().Format(time.DateTime), compared.To.Local().Format(time.DateTime))
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	if !sf.Quiet {
+		fmt.Fprintln(w, "CRD\tINSTANCES\tCHANGE\tSIZE\tSIZE CHANGE")
+	}
+	for _, t := range trends {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", t.CRD, t.To.Instances, formatChange(t.From.Instances, t.To.Instances),
+			output.FormatSize(int(t.To.Bytes), 0), formatSizeChange(t.From.Bytes, t.To.Bytes))
+	}
+	w.Flush()
+
+	// Trends are sorted by growth: the first makes the headline, unless it is a new CRD
+	if len(trends) > 0 {
+		if growth, ok := trends[0].Growth(); ok && growth > 0 {
+			say(&sf, os.Stderr, "%s grew %.0f%% since %s\n", trends[0].CRD, growth*100, compared.From.Local().Format(time.DateOnly))
+		}
+	}
+}
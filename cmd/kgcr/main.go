@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"kgcr/internal/config"
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// version is set by release builds with -ldflags "-X main.version=...".
+var version = "dev"
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "policy":
+			runPolicy(os.Args[2:])
+			return
+		case "refs":
+			runRefs(os.Args[2:])
+			return
+		case "expired":
+			runExpired(os.Args[2:])
+			return
+		case "scan-secrets":
+			runScanSecrets(os.Args[2:])
+			return
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "top-size":
+			runTopSize(os.Args[2:])
+			return
+		case "controllers":
+			runControllers(os.Args[2:])
+			return
+		case "get":
+			runGet(os.Args[2:])
+			return
+		case "graph":
+			runGraph(os.Args[2:])
+			return
+		case "matrix":
+			runMatrix(os.Args[2:])
+			return
+		case "mcp":
+			runMCP(os.Args[2:])
+			return
+		case "audit":
+			runAudit(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "top":
+			runTop(os.Args[2:])
+			return
+		case "collisions":
+			runCollisions(os.Args[2:])
+			return
+		case "version", "-version", "--version":
+			runVersion(os.Args[2:])
+			return
+		}
+	}
+	runList()
+}
+
+// runList is the default command: a table of every custom resource instance found.
+func runList() {
+	var sf config.Flags
+	sf.Register(flag.CommandLine)
+	requireLabels := flag.String("require-labels", "", "comma-separated label keys every custom resource must have; lists the instances missing any of them with a per-namespace summary")
+	sortBy := flag.String("sort-by", "crd", "sort the results by name, namespace, crd, age (youngest first), group or count (largest CRDs first; also orders summary rows and tree nodes)")
+	reverse := flag.Bool("reverse", false, "reverse the -sort-by order")
+	showSize := flag.Bool("show-size", false, "add a SIZE column with the serialized size of each instance")
+	columnSpec := flag.String("columns", "", "comma-separated columns to display, in order. One of: "+output.ColumnNames())
+	short := flag.Bool("short", false, "show RESOURCE and GROUP columns instead of the full CRD name")
+	timestamps := flag.String("timestamps", "rfc3339", "format of the CREATED column: rfc3339 or relative")
+	showAnnotations := flag.String("show-annotations", "", "comma-separated annotation keys to add as columns, e.g. meta.helm.sh/release-name")
+	groupBy := flag.String("group-by", "", "render the results in sections; 'operator' groups them by the OLM operator or app.kubernetes.io/part-of label of their CRD, 'system' by the app.kubernetes.io/part-of or app.kubernetes.io/name label of each instance, else its API group")
+	outputFormat := flag.String("o", "table", "output format: table, wide, name, tree, json, ndjson (one instance per line, streamed while scanning), yaml, sqlite, parquet or xlsx")
+	sheetBy := flag.String("sheet-by", "namespace", "with -o xlsx, add a sheet per namespace or per API group ('group') after the summary sheet")
+	outputFile := flag.String("output-file", "", "write the output to this file instead of stdout; required for -o sqlite, which adds a run to the database in it")
+	clean := flag.Bool("clean", false, "with -o json, ndjson or yaml, strip managedFields, status, resourceVersion, uid and creationTimestamp so the output can be re-applied")
+	colorMode := flag.String("color", "auto", "color the output: auto (only on a terminal, unless NO_COLOR is set), always or never")
+	summaryByNamespace := flag.Bool("summary-by-namespace", false, "with -A, print one row per namespace with its instance count and top CRDs instead of the instances")
+	summaryByGroup := flag.Bool("summary-by-group", false, "print one row per API group with its instance count and a bar chart instead of the instances")
+	failIfFound := flag.Bool("fail-if-found", false, "exit with status 1 if any matching custom resource exists, e.g. as a teardown gate; 2 if a resource type could not be listed")
+	failIfNone := flag.Bool("fail-if-none", false, "exit with status 1 if no custom resource matches, e.g. as a smoke test; 2 if a resource type could not be listed")
+	watch := flag.Bool("watch", false, "keep watching and print a timestamped ADDED, MODIFIED or DELETED line for every instance change until interrupted, starting with one ADDED line per instance; with -o json, one JSON event per line")
+	flag.BoolVar(watch, "w", false, "shorthand for -watch")
+	var thresholds thresholdFlag
+	flag.Var(&thresholds, "max-count", "exit with status 1 if a CRD has more instances than allowed, as <crd>=<n> with a CRD name, a Kind or * for every CRD; comma-separated or repeated. Exits with status 2 if a resource type could not be listed")
+	thresholdFile := flag.String("thresholds", "", "YAML file of instance count limits, optionally with a CEL where expression each; see the README")
+	redact := flag.Bool("redact", false, "replace namespaces, names and UIDs with tokens that are consistent within the run but cannot be traced back, keeping CRDs, kinds and counts, to share inventories outside the organization")
+	showQuota := flag.Bool("show-quota", false, "print one row per CRD and namespace with its instances next to the ResourceQuota object-count limits (count/<resource>.<group>) on it, flagging namespaces at 80% of a limit or more")
+	pluginOutput := flag.Bool("plugin-output", false, "print stable, uncolored, tab-separated NAMESPACE, NAME, RESOURCE, KIND, APIVERSION and CREATED fields for k9s plugins and other wrappers; -q drops the header")
+	sf.Parse(flag.CommandLine, os.Args[1:])
+
+	if !output.Formats[*outputFormat] {
+		fatal(fmt.Errorf("invalid -o %q: must be table, wide, name, tree, json, ndjson, yaml, sqlite, parquet or xlsx", *outputFormat))
+	}
+	if !output.SheetKeys[*sheetBy] {
+		fatal(fmt.Errorf("invalid -sheet-by %q: must be namespace or group", *sheetBy))
+	}
+	if *outputFormat == "sqlite" && *outputFile == "" {
+		fatal(errors.New("-o sqlite needs -output-file"))
+	}
+	out := os.Stdout
+	if *outputFile != "" && *outputFormat != "sqlite" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if (*outputFormat == "parquet" || *outputFormat == "xlsx") && output.IsTerminal(out) {
+		fatal(fmt.Errorf("-o %s writes binary data; redirect stdout or use -output-file", *outputFormat))
+	}
+
+	colored, err := output.UseColor(*colorMode, out)
+	if err != nil {
+		fatal(err)
+	}
+
+	var columns []output.Column
+	if *columnSpec != "" {
+		columns, err = output.ParseColumns(*columnSpec)
+		if err != nil {
+			fatal(fmt.Errorf("invalid -columns: %w", err))
+		}
+	}
+
+	if *groupBy != "" && !scan.GroupByKeys[*groupBy] {
+		fatal(fmt.Errorf("invalid -group-by %q: must be operator or system", *groupBy))
+	}
+	if *timestamps != "rfc3339" && *timestamps != "relative" {
+		fatal(fmt.Errorf("invalid -timestamps %q: must be rfc3339 or relative", *timestamps))
+	}
+	if *failIfFound && *failIfNone {
+		fatal(errors.New("-fail-if-found and -fail-if-none cannot be used together"))
+	}
+	if _, ok := scan.SortKeys[*sortBy]; !ok {
+		fatal(fmt.Errorf("invalid -sort-by %q: must be one of name, namespace, crd, age, group, count", *sortBy))
+	}
+	if *watch && (*outputFormat != "table" && *outputFormat != "wide" && *outputFormat != "json" || *summaryByNamespace || *summaryByGroup || *groupBy != "" || *requireLabels != "" || *failIfFound || *failIfNone || len(thresholds) > 0 || *thresholdFile != "") {
+		fatal(errors.New("-watch only prints events: it cannot be used with -o other than table, wide or json, summaries, -group-by, -require-labels, -fail-if-* or thresholds"))
+	}
+
+	if *outputFormat == "ndjson" && (*summaryByNamespace || *summaryByGroup || *groupBy != "" || *requireLabels != "" || *watch) {
+		fatal(errors.New("-o ndjson streams instances as they are found: it cannot be used with summaries, -group-by, -require-labels or -watch"))
+	}
+	if *redact && (!output.RedactFormats[*outputFormat] || *showAnnotations != "" || *watch) {
+		fatal(errors.New("-redact only works with -o table, wide, name, tree or xlsx, which carry no full objects or labels, and not with -show-annotations or -watch"))
+	}
+	if *redact && sf.JQExpression != "" && sf.JQMode == "column" {
+		fatal(errors.New("-redact cannot be used with a -jq column, whose values it cannot redact"))
+	}
+	if *pluginOutput && (*outputFormat != "table" || *columnSpec != "" || *summaryByNamespace || *summaryByGroup || *groupBy != "" || *requireLabels != "" || *watch) {
+		fatal(errors.New("-plugin-output has fixed fields: it cannot be used with -o, -columns, summaries, -group-by, -require-labels or -watch"))
+	}
+
+	if *watch && sf.ListStrategy == "per-namespace" {
+		fatal(errors.New("-watch keeps one cluster-wide watch per resource type and cannot be used with -list-strategy per-namespace"))
+	}
+	if *watch && sf.Incremental {
+		fatal(errors.New("-watch keeps its instances current itself and cannot be used with -incremental"))
+	}
+	if *showQuota && (*outputFormat != "table" || *columnSpec != "" || *summaryByNamespace || *summaryByGroup || *groupBy != "" || *requireLabels != "" || *watch || *pluginOutput || *redact) {
+		fatal(errors.New("-show-quota prints its own table: it cannot be used with -o, -columns, summaries, -group-by, -require-labels, -watch, -plugin-output or -redact"))
+	}
+
+	if *thresholdFile != "" {
+		loaded, err := scan.LoadThresholds(*thresholdFile)
+		if err != nil {
+			fatal(err)
+		}
+		thresholds = append(thresholds, loaded...)
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	if len(thresholds) > 0 && s.LimitPerCRD > 0 {
+		fatal(errors.New("-max-count and -thresholds need full counts and cannot be used with -limit-per-crd"))
+	}
+	if *summaryByNamespace && *summaryByGroup {
+		fatal(errors.New("-summary-by-namespace and -summary-by-group cannot be used together"))
+	}
+	if *summaryByNamespace && !s.AllNamespaces {
+		fatal(errors.New("-summary-by-namespace needs -A"))
+	}
+	s.ComputeSize = s.ComputeSize || *showSize || output.HasColumn(columns, "SIZE") || *outputFormat == "sqlite" || *outputFormat == "parquet"
+	opts := &output.Options{
+		AllNamespaces:      s.AllNamespaces,
+		JQ:                 s.JQColumn != nil,
+		Size:               s.ComputeSize,
+		Source:             s.Discovery,
+		Operator:           s.Operator,
+		Short:              *short,
+		SizeWarning:        s.SizeWarning,
+		RelativeTimestamps: *timestamps == "relative",
+		Colored:            colored,
+		NoHeaders:          sf.Quiet,
+		SortByCount:        *sortBy == "count",
+		Reverse:            *reverse,
+	}
+	if columns == nil {
+		columns = output.DefaultColumns(opts)
+		if *outputFormat == "wide" {
+			columns = append(columns, output.WideColumns()...)
+		}
+	}
+	s.KeepObjects = *outputFormat == "json" || *outputFormat == "ndjson" || *outputFormat == "yaml" || *outputFormat == "sqlite" || *outputFormat == "parquet" || scan.NeedsObjects(thresholds)
+	// With JSON or YAML output, -stats goes under a stats key instead of to stderr
+	var stats *scan.Stats
+	if (*outputFormat == "json" || *outputFormat == "yaml") && s.PrintStats {
+		s.PrintStats = false
+		stats = &s.Stats
+	}
+	if *showAnnotations != "" {
+		s.ShowAnnotations = strings.Split(*showAnnotations, ",")
+		for _, key := range s.ShowAnnotations {
+			columns = append(columns, output.AnnotationColumn(key))
+		}
+	}
+	if *requireLabels != "" {
+		s.RequireLabels = strings.Split(*requireLabels, ",")
+	}
+	s.ResolveSystems = *groupBy == "system"
+
+	// Instances are written as each page arrives, so -sort-by does not apply
+	if *outputFormat == "ndjson" {
+		s.OnResults = func(results []scan.Result) {
+			if err := output.WriteNDJSON(out, results, *clean); err != nil {
+				fatal(err)
+			}
+		}
+	}
+
+	if *watch {
+		watchList(s, &sf, out, *outputFormat, *clean, columns, opts, *sortBy, *reverse)
+		return
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		say(&sf, os.Stderr, "No namespaced custom resources found in cluster\n")
+		if *failIfNone {
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	if *redact {
+		output.NewRedactor().Results(allResults)
+		// Re-sort by the tokens, so the order gives nothing away about the names
+		scan.SortDefault(allResults)
+	}
+	scan.SortResults(allResults, *sortBy, *reverse)
+
+	// Only the table has room for "... and N more" rows; other formats get a warning
+	opts.Overflow = s.Overflow
+	if len(s.Overflow) > 0 && *outputFormat != "table" && *outputFormat != "wide" {
+		slog.Warn("results truncated by -limit-per-crd", "crds", len(s.Overflow))
+	}
+
+	switch {
+	case len(s.RequireLabels) > 0:
+		if len(allResults) == 0 {
+			sayNoneFound(&sf, s)
+		} else if output.PrintLabelAudit(out, allResults, opts) == 0 {
+			say(&sf, os.Stderr, "All %d custom resources have the required labels: %s\n", len(allResults), strings.Join(s.RequireLabels, ","))
+		}
+	case *outputFormat == "json" || *outputFormat == "yaml":
+		if err := output.PrintObjects(out, allResults, *outputFormat, *clean, stats); err != nil {
+			fatal(err)
+		}
+	case *outputFormat == "ndjson":
+		// Already streamed by s.OnResults
+	case *outputFormat == "sqlite":
+		// Empty runs are recorded too, so history shows when instances disappeared
+		if err := output.WriteSQLite(*outputFile, allResults, s.Cluster, s.Namespace, *clean); err != nil {
+			fatal(err)
+		}
+		say(&sf, os.Stderr, "Wrote %d custom resources to %s\n", len(allResults), *outputFile)
+	case *outputFormat == "parquet":
+		if err := output.WriteParquet(out, allResults, s.Cluster); err != nil {
+			fatal(err)
+		}
+	case *outputFormat == "xlsx":
+		if err := output.WriteXLSX(out, allResults, *sheetBy, columns, opts); err != nil {
+			fatal(err)
+		}
+	case *pluginOutput:
+		// Wrappers expect the header even when nothing is found
+		output.PrintPlugin(out, allResults, opts)
+	case *showQuota:
+		// Quotas show even on CRDs without instances
+		limits, err := s.QuotaLimits(ctx)
+		if err != nil {
+			fatal(err)
+		}
+		if len(allResults) == 0 && len(limits) == 0 {
+			say(&sf, os.Stderr, "No custom resources or object-count quotas on them found\n")
+			break
+		}
+		if near := output.PrintQuotaUsage(out, allResults, limits, opts); len(near) > 0 {
+			say(&sf, os.Stderr, "Close to an object-count quota (%.0f%% used or more): %s\n", output.QuotaNearLimit*100, strings.Join(near, ", "))
+		}
+	case len(allResults) == 0:
+		sayNoneFound(&sf, s)
+	case *summaryByNamespace:
+		output.PrintNamespaceSummary(out, allResults, opts)
+	case *summaryByGroup:
+		output.PrintGroupSummary(out, allResults, opts)
+	case *outputFormat == "name":
+		output.PrintNames(out, allResults)
+	case *outputFormat == "tree":
+		output.PrintTree(out, allResults, opts)
+	case *groupBy == "operator":
+		output.PrintGroups(out, s.GroupByOperator(ctx, allResults), "Operator", columns, opts)
+	case *groupBy == "system":
+		output.PrintGroups(out, scan.GroupBySystem(allResults), "System", columns, opts)
+	default:
+		output.PrintTable(out, allResults, columns, opts)
+	}
+	if s.FromCache {
+		say(&sf, os.Stderr, "Note: listed from the API server's cache with -from-cache; results may be slightly stale\n")
+	}
+
+	// Exit statuses for CI assertions, set after the output so a failing gate still shows why.
+	// A resource type that could not be listed may hold instances, so such a scan is no
+	// answer either way.
+	if *failIfFound || *failIfNone || len(thresholds) > 0 {
+		failIncomplete(&s.Stats)
+	}
+	if *failIfFound && len(allResults) > 0 || *failIfNone && len(allResults) == 0 {
+		os.Exit(1)
+	}
+	violations, err := scan.CheckThresholds(ctx, thresholds, allResults)
+	if err != nil {
+		fatal(err)
+	}
+	for _, v := range violations {
+		slog.Error("threshold exceeded: " + v.String())
+	}
+	if len(violations) > 0 {
+		os.Exit(1)
+	}
+}
+
+// thresholdFlag collects repeated or comma-separated -max-count crd=n flags.
+type thresholdFlag []scan.Threshold
+
+func (t *thresholdFlag) String() string {
+	specs := make([]string, len(*t))
+	for i, threshold := range *t {
+		specs[i] = fmt.Sprintf("%s=%d", threshold.CRD, threshold.Max)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (t *thresholdFlag) Set(value string) error {
+	for _, spec := range strings.Split(value, ",") {
+		threshold, err := scan.ParseThreshold(spec)
+		if err != nil {
+			return err
+		}
+		*t = append(*t, threshold)
+	}
+	return nil
+}
+
+// failIncomplete logs the resource types a scan could not list and exits with status 2,
+// if there are any.
+func failIncomplete(stats *scan.Stats) {
+	err := stats.CheckComplete()
+	if err == nil {
+		return
+	}
+	for _, p := range stats.ListFailures {
+		slog.Error("listing failed", "crd", p.CRD, "error", p.Message)
+	}
+	slog.Error(err.Error())
+	os.Exit(2)
+}
+
+// fatal logs err and exits with status 1.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// sayNoneFound reports that the scan found no custom resources. Like kubectl, it does so
+// on stderr so that pipelines see no output.
+func sayNoneFound(sf *config.Flags, s *scan.Scanner) {
+	if s.AllNamespaces {
+		say(sf, os.Stderr, "No custom resources found in any namespace\n")
+	} else {
+		say(sf, os.Stderr, "No custom resources found in namespace: %s\n", s.Namespace)
+	}
+}
+
+// say writes a message meant for people, such as "No custom resources found", to w unless -q is set.
+func say(sf *config.Flags, w io.Writer, format string, a ...interface{}) {
+	if !sf.Quiet {
+		fmt.Fprintf(w, format, a...)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// runMatrix implements `kgcr matrix -kind A,B`: a namespaces × kinds table of instance
+// counts, showing which namespaces lack an instance of a kind, e.g. to check that every
+// tenant namespace has its NetworkPolicyTemplate.
+func runMatrix(args []string) {
+	fs := flag.NewFlagSet("matrix", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	kinds := fs.String("kind", "", "comma-separated Kinds to use as columns, e.g. NetworkPolicyTemplate,ResourceQuotaTemplate (case-insensitive); Kind.group, e.g. Certificate.cert-manager.io, picks one of several groups sharing a Kind")
+	namespaceSelector := fs.String("namespace-selector", "", "only use the namespaces matching this label selector as rows, e.g. 'tenant=true'")
+	missing := fs.Bool("missing", false, "only list the namespaces lacking an instance of some kind, and exit with status 1 if there are any")
+	sf.Parse(fs, args)
+
+	if *kinds == "" {
+		*kinds = sf.ByKind
+	}
+	if *kinds == "" {
+		fatal(errors.New("kgcr matrix needs -kind"))
+	}
+	var columns []string
+	for _, kind := range strings.Split(*kinds, ",") {
+		columns = append(columns, strings.TrimSpace(kind))
+	}
+	sf.ByKind = *kinds
+	// A matrix spans namespaces: without -n, every namespace is a row
+	if sf.Namespace == "" {
+		sf.AllNamespaces = true
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+
+	// Rows are the cluster's namespaces, so the ones without any instance show up too
+	var namespaces []string
+	if s.AllNamespaces {
+		namespaces, err = s.Namespaces(ctx, *namespaceSelector)
+		if err != nil {
+			if *namespaceSelector != "" {
+				fatal(err)
+			}
+			slog.Warn("only showing namespaces with instances", "error", err)
+		}
+		if s.NamespaceRegex != nil {
+			namespaces = slices.DeleteFunc(namespaces, func(ns string) bool { return !s.NamespaceRegex.MatchString(ns) })
+		}
+	} else {
+		namespaces = []string{s.Namespace}
+	}
+	rows := map[string]bool{}
+	for _, ns := range namespaces {
+		rows[ns] = true
+	}
+	// Counts by namespace, one per column
+	counts := map[string][]int{}
+	for _, res := range allResults {
+		if *namespaceSelector != "" && !rows[res.Namespace] {
+			continue
+		}
+		if !rows[res.Namespace] {
+			rows[res.Namespace] = true
+			namespaces = append(namespaces, res.Namespace)
+		}
+		if counts[res.Namespace] == nil {
+			counts[res.Namespace] = make([]int, len(columns))
+		}
+		for i, kind := range columns {
+			if !scan.KindMatches(kind, res.Kind, res.GVR.Group) {
+				continue
+			}
+			counts[res.Namespace][i]++
+			// Show the Kind as the API spells it
+			if strings.Contains(kind, ".") {
+				columns[i] = res.Kind + "." + res.GVR.Group
+			} else {
+				columns[i] = res.Kind
+			}
+		}
+	}
+	sort.Strings(namespaces)
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	printed, lacking := 0, 0
+	for _, ns := range namespaces {
+		cells := []string{ns}
+		gap := false
+		for i := range columns {
+			n := 0
+			if counts[ns] != nil {
+				n = counts[ns][i]
+			}
+			if n == 0 {
+				cells = append(cells, "-")
+				gap = true
+			} else {
+				cells = append(cells, strconv.Itoa(n))
+			}
+		}
+		if *missing && !gap {
+			continue
+		}
+		if gap {
+			lacking++
+		}
+		if printed == 0 && !sf.Quiet {
+			fmt.Fprintln(w, "NAMESPACE\t"+strings.Join(columns, "\t"))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+		printed++
+	}
+	w.Flush()
+
+	if *missing {
+		if lacking == 0 {
+			say(&sf, os.Stderr, "Every namespace has an instance of %s\n", strings.Join(columns, ", "))
+			return
+		}
+		os.Exit(1)
+	}
+}
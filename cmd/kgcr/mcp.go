@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+
+	"kgcr/internal/config"
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// mcpProtocolVersion is the newest Model Context Protocol revision `kgcr mcp` speaks;
+// clients asking for an older one get theirs, as the tools work the same in all.
+const mcpProtocolVersion = "2025-06-18"
+
+// rpcMessage is a JSON-RPC 2.0 request, notification (no ID) or response.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// mcpTool is a tool in the tools/list result.
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations map[string]interface{} `json:"annotations"`
+}
+
+// mcpProperty returns a JSON Schema property of the given type.
+func mcpProperty(typ, description string) map[string]interface{} {
+	return map[string]interface{}{"type": typ, "description": description}
+}
+
+// mcpTools are the tools `kgcr mcp` serves, all read-only.
+var mcpTools = []mcpTool{
+	{
+		Name:        "list-custom-resources",
+		Description: "List the custom resource instances in the cluster as a table with their namespace, CRD, name and age.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"namespace":     mcpProperty("string", "Namespace to list; defaults to the kubeconfig context's namespace"),
+				"allNamespaces": mcpProperty("boolean", "List every namespace"),
+				"kinds":         mcpProperty("string", "Comma-separated Kinds to list, e.g. Certificate,Issuer (case-insensitive); defaults to all"),
+				"cel":           mcpProperty("string", "Only list instances for which this CEL expression is true, e.g. 'object.spec.replicas > 3'"),
+			},
+		},
+	},
+	{
+		Name:        "get-resource-yaml",
+		Description: "Get the full YAML of a custom resource instance by name, or part of its name, across all CRDs.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name":      mcpProperty("string", "Name, or part of the name, of the instance"),
+				"namespace": mcpProperty("string", "Namespace of the instance; defaults to all namespaces"),
+				"kinds":     mcpProperty("string", "Comma-separated Kinds to search (case-insensitive); defaults to all"),
+			},
+			"required": []string{"name"},
+		},
+	},
+	{
+		Name:        "summarize-by-namespace",
+		Description: "Summarize custom resources per namespace: instance and CRD counts and the CRDs with the most instances.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"kinds": mcpProperty("string", "Comma-separated Kinds to count (case-insensitive); defaults to all"),
+			},
+		},
+	},
+}
+
+func init() {
+	for i := range mcpTools {
+		mcpTools[i].Annotations = map[string]interface{}{"readOnlyHint": true, "openWorldHint": false}
+	}
+}
+
+// mcpArgs are the arguments of any kgcr tool; each tool uses some of them.
+type mcpArgs struct {
+	Name          string `json:"name"`
+	Namespace     string `json:"namespace"`
+	AllNamespaces bool   `json:"allNamespaces"`
+	Kinds         string `json:"kinds"`
+	CEL           string `json:"cel"`
+}
+
+// mcpServer answers MCP requests from an informer cache of the instances the server may
+// show. The Kinds and filters given when the server started bound the cache, which a
+// call's arguments can only narrow.
+type mcpServer struct {
+	sf        *config.Flags
+	s         *scan.Scanner
+	namespace string // the namespace list-custom-resources defaults to
+
+	mu        sync.Mutex
+	instances map[string]scan.Result // by CRD, namespace and name; nil until the first tool call
+}
+
+// runMCP implements `kgcr mcp`: a Model Context Protocol server on stdin and stdout that
+// lets AI assistants list custom resources, read one's YAML and summarize namespaces. It
+// only ever reads from the cluster.
+func runMCP(args []string) {
+	fs := flag.NewFlagSet("mcp", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	sf.Parse(fs, args)
+
+	// stdout carries the protocol: nothing else may be printed there
+	sf.Progress = false
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	srv := &mcpServer{sf: &sf, s: s, namespace: s.Namespace}
+	if err := srv.serve(os.Stdin, os.Stdout); err != nil {
+		fatal(err)
+	}
+}
+
+// mcpKey identifies res in the cache.
+func mcpKey(res *scan.Result) string {
+	return res.CRDName + "/" + res.Namespace + "/" + res.InstanceName
+}
+
+// cached returns the instances in the cache, starting the informers on the first call so
+// that the server answers initialize at once. The informers then keep the cache current
+// through watches, so tool calls do not list the cluster again.
+func (srv *mcpServer) cached() ([]scan.Result, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.instances == nil {
+		s := srv.s
+		s.Namespace, s.AllNamespaces, s.KeepObjects = "", true, true
+		// Events wait for mu until the initial instances are in
+		results, err := s.Watch(context.Background(), srv.sf.Timeout, func(ev scan.Event) {
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if ev.Type == scan.Deleted {
+				delete(srv.instances, mcpKey(&ev.Result))
+			} else {
+				srv.instances[mcpKey(&ev.Result)] = ev.Result
+			}
+		})
+		if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+			return nil, err
+		}
+		srv.instances = map[string]scan.Result{}
+		for i := range results {
+			srv.instances[mcpKey(&results[i])] = results[i]
+		}
+	}
+	results := make([]scan.Result, 0, len(srv.instances))
+	for _, res := range srv.instances {
+		results = append(results, res)
+	}
+	scan.SortDefault(results)
+	return results, nil
+}
+
+// serve reads one JSON-RPC message per line from in and writes the responses to out,
+// until in ends.
+func (srv *mcpServer) serve(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	enc := json.NewEncoder(out)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req rpcMessage
+		if err := json.Unmarshal(line, &req); err != nil {
+			if err := enc.Encode(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		// Notifications, such as notifications/initialized, get no response
+		if req.ID == nil {
+			slog.Debug("mcp notification", "method", req.Method)
+			continue
+		}
+		resp := rpcMessage{JSONRPC: "2.0", ID: req.ID}
+		resp.Result, resp.Error = srv.handle(&req)
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// handle returns the result of a request, or its error.
+func (srv *mcpServer) handle(req *rpcMessage) (interface{}, *rpcError) {
+	slog.Debug("mcp request", "method", req.Method)
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params) //nolint:errcheck // the version is optional
+		protocolVersion := mcpProtocolVersion
+		if params.ProtocolVersion != "" && params.ProtocolVersion < mcpProtocolVersion {
+			protocolVersion = params.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": protocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "kgcr", "version": version},
+			"instructions":    "kgcr finds custom resource instances across all CRDs in a Kubernetes cluster. Its tools only read.",
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": mcpTools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		var args mcpArgs
+		if len(params.Arguments) > 0 {
+			if err := json.Unmarshal(params.Arguments, &args); err != nil {
+				return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("invalid arguments: %v", err)}
+			}
+		}
+		text, err := srv.call(params.Name, &args)
+		if errors.Is(err, errUnknownTool) {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		// Tool failures are results the assistant can read, not protocol errors
+		if err != nil {
+			return mcpText(err.Error(), true), nil
+		}
+		return mcpText(text, false), nil
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+}
+
+func mcpText(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]interface{}{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+var errUnknownTool = errors.New("unknown tool")
+
+// call runs the named tool and returns its text output.
+func (srv *mcpServer) call(name string, args *mcpArgs) (string, error) {
+	var namespace string // empty for all namespaces
+	switch name {
+	case "list-custom-resources":
+		namespace = cmp.Or(args.Namespace, srv.namespace)
+		if args.AllNamespaces {
+			namespace = ""
+		}
+	case "get-resource-yaml":
+		if args.Name == "" {
+			return "", errors.New("name is required")
+		}
+		namespace = args.Namespace
+	case "summarize-by-namespace":
+	default:
+		return "", fmt.Errorf("%w %q", errUnknownTool, name)
+	}
+	var kinds []string
+	if args.Kinds != "" {
+		for _, kind := range strings.Split(args.Kinds, ",") {
+			kinds = append(kinds, strings.TrimSpace(kind))
+		}
+	}
+	var filters []scan.Filter
+	if args.CEL != "" {
+		filter, err := scan.NewCELFilter(args.CEL)
+		if err != nil {
+			return "", fmt.Errorf("parsing cel expression: %w", err)
+		}
+		filters = append(filters, filter)
+	}
+
+	cached, err := srv.cached()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), srv.sf.Timeout)
+	defer cancel()
+	var results []scan.Result
+	for _, res := range cached {
+		if namespace != "" && res.Namespace != namespace {
+			continue
+		}
+		if kinds != nil && !slices.ContainsFunc(kinds, func(kind string) bool { return scan.KindMatches(kind, res.Kind, res.GVR.Group) }) {
+			continue
+		}
+		if filters != nil && !scan.MatchesAll(ctx, filters, res.Object) {
+			continue
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 {
+		return "No custom resources found.", nil
+	}
+
+	var buf bytes.Buffer
+	opts := &output.Options{AllNamespaces: namespace == ""}
+	switch name {
+	case "list-custom-resources":
+		output.PrintTable(&buf, results, output.DefaultColumns(opts), opts)
+	case "summarize-by-namespace":
+		output.PrintNamespaceSummary(&buf, results, opts)
+	case "get-resource-yaml":
+		matches := matchName(results, args.Name)
+		if len(matches) == 0 {
+			return fmt.Sprintf("No custom resources match %q.", args.Name), nil
+		}
+		if len(matches) > 1 {
+			fmt.Fprintf(&buf, "%d custom resources match %q; ask again with the full name, a namespace or kinds:\n", len(matches), args.Name)
+			output.PrintNames(&buf, matches)
+			break
+		}
+		obj, err := output.ExportObject(&matches[0], false)
+		if err != nil {
+			return "", err
+		}
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		buf.Write(data)
+	}
+	return expandTabs(buf.String()), nil
+}
+
+// expandTabs replaces the tabs the tables are aligned with by spaces, to the next multiple
+// of eight columns, as a terminal would show them; assistants read spaces more reliably.
+func expandTabs(s string) string {
+	var b strings.Builder
+	column := 0
+	for _, r := range s {
+		switch r {
+		case '\t':
+			n := 8 - column%8
+			b.WriteString(strings.Repeat(" ", n))
+			column += n
+		case '\n':
+			b.WriteRune(r)
+			column = 0
+		default:
+			b.WriteRune(r)
+			column++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// regoPolicy is a prepared Rego query whose results are the violations for one instance.
+type regoPolicy struct {
+	query rego.PreparedEvalQuery
+}
+
+// newRegoPolicy loads the policies (and any JSON/YAML data files) under path and prepares query against them.
+func newRegoPolicy(ctx context.Context, query, path string) (*regoPolicy, error) {
+	prepared, err := rego.New(
+		rego.Query(query),
+		rego.Load([]string{path}, nil),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &regoPolicy{query: prepared}, nil
+}
+
+// evaluate runs the query with obj as input and returns one message per violation.
+// Rules may produce plain strings or objects with a "msg" field, as in Gatekeeper and conftest.
+func (p *regoPolicy) evaluate(ctx context.Context, obj *unstructured.Unstructured) ([]string, error) {
+	rs, err := p.query.Eval(ctx, rego.EvalInput(obj.Object))
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for _, result := range rs {
+		for _, expr := range result.Expressions {
+			values, ok := expr.Value.([]interface{})
+			if !ok {
+				// A single-valued rule such as `deny := true`
+				if expr.Value != false && expr.Value != nil {
+					messages = append(messages, fmt.Sprint(expr.Value))
+				}
+				continue
+			}
+			for _, v := range values {
+				messages = append(messages, violationMessage(v))
+			}
+		}
+	}
+	sort.Strings(messages)
+	return messages, nil
+}
+
+func violationMessage(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if msg, ok := v["msg"].(string); ok {
+			return msg
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// runPolicy implements `kgcr policy`: evaluate Rego rules against every custom resource
+// found and report violations per instance. It exits with status 1 when any are found.
+func runPolicy(args []string) {
+	fs := flag.NewFlagSet("policy", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	regoPath := fs.String("rego", "", "a .rego file or a directory of policies to evaluate (required)")
+	query := fs.String("query", "data.kgcr.deny", "the Rego query that yields the violations for an instance")
+	sf.Parse(fs, args)
+
+	if *regoPath == "" {
+		fatal(errors.New("-rego is required"))
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	policy, err := newRegoPolicy(ctx, *query, *regoPath)
+	if err != nil {
+		fatal(fmt.Errorf("loading policies: %w", err))
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.KeepObjects = true
+
+	allResults, err := s.Scan(ctx)
+	if errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		say(&sf, os.Stderr, "No namespaced custom resources found in cluster\n")
+		return
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	violations, violating := 0, 0
+	for _, res := range allResults {
+		obj, err := res.LoadObject()
+		if err != nil {
+			fatal(err)
+		}
+		messages, err := policy.evaluate(context.Background(), obj)
+		if err != nil {
+			messages = []string{"policy evaluation failed: " + err.Error()}
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		if violations == 0 && !sf.Quiet {
+			fmt.Fprintln(w, "NAMESPACE\tCRD\tNAME\tVIOLATION")
+		}
+		for _, msg := range messages {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", res.Namespace, res.CRDName, res.InstanceName, msg)
+		}
+		violations += len(messages)
+		violating++
+	}
+	w.Flush()
+
+	if violations == 0 {
+		say(&sf, os.Stderr, "No policy violations found in %d custom resources\n", len(allResults))
+		return
+	}
+	say(&sf, os.Stderr, "%d violations in %d of %d custom resources\n", violations, violating, len(allResults))
+	os.Exit(1)
+}
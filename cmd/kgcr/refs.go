@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// refKinds maps the accepted spellings of a referenceable kind to the keyword that
+// marks a field as pointing at that kind (secretName, configMapRef, serviceName, ...).
+var refKinds = map[string]string{
+	"secret":     "secret",
+	"secrets":    "secret",
+	"configmap":  "configmap",
+	"configmaps": "configmap",
+	"cm":         "configmap",
+	"service":    "service",
+	"services":   "service",
+	"svc":        "service",
+}
+
+// refTarget is the object whose references are searched for, e.g. secret/my-tls.
+type refTarget struct {
+	keyword   string // lowercase keyword that field names mentioning this kind contain
+	namespace string // empty until resolved from -n or the kubeconfig context
+	name      string
+	paths     [][]string // extra dot paths (from -path) that hold a reference
+}
+
+// parseRefTarget parses "kind/name" or "kind/namespace/name" as accepted by `kgcr refs`.
+func parseRefTarget(arg string) (*refTarget, error) {
+	parts := strings.Split(arg, "/")
+	if len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+		return nil, fmt.Errorf("expected <kind>/<name> or <kind>/<namespace>/<name>, got %q", arg)
+	}
+	keyword, ok := refKinds[strings.ToLower(parts[0])]
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind %q: must be secret, configmap or service", parts[0])
+	}
+	t := &refTarget{keyword: keyword, name: parts[len(parts)-1]}
+	if len(parts) == 3 {
+		t.namespace = parts[1]
+	}
+	return t, nil
+}
+
+// find returns the paths in obj, an instance in namespace, that reference the target.
+// The spec is searched heuristically: a field whose name mentions the kind (secretName,
+// tlsSecretRef, configMapKeyRef, backend.service, ...) holding the name directly or in a
+// "name" field, or an object reference with a matching "kind" and "name". A reference
+// points into the instance's own namespace, unless it has a "namespace" field.
+// Paths configured with -path are checked as well, relative to the object root.
+func (t *refTarget) find(obj map[string]interface{}, namespace string) []string {
+	var found []string
+	if spec, ok := obj["spec"]; ok {
+		found = t.walk(spec, "spec", namespace, found)
+	}
+	for _, path := range t.paths {
+		found = t.lookup(obj, path, strings.Join(path, "."), namespace, found)
+	}
+	sort.Strings(found)
+	return found
+}
+
+func (t *refTarget) walk(node interface{}, path, namespace string, found []string) []string {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if kind, ok := node["kind"].(string); ok && strings.ToLower(kind) == t.keyword && t.holdsName(node, namespace) {
+			found = append(found, path+".name")
+		}
+		for key, value := range node {
+			child := path + "." + key
+			if t.mentionsKind(key) {
+				if t.holdsName(value, namespace) {
+					if _, ok := value.(map[string]interface{}); ok {
+						child += ".name"
+					}
+					found = append(found, child)
+					continue
+				}
+			}
+			found = t.walk(value, child, namespace, found)
+		}
+	case []interface{}:
+		for i, value := range node {
+			found = t.walk(value, path+"["+strconv.Itoa(i)+"]", namespace, found)
+		}
+	}
+	return found
+}
+
+// lookup follows a configured dot path, fanning out over lists along the way.
+func (t *refTarget) lookup(node interface{}, path []string, display, namespace string, found []string) []string {
+	if list, ok := node.([]interface{}); ok {
+		for _, item := range list {
+			found = t.lookup(item, path, display, namespace, found)
+		}
+		return found
+	}
+	if len(path) == 0 {
+		if t.holdsName(node, namespace) {
+			found = append(found, display)
+		}
+		return found
+	}
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return found
+	}
+	return t.lookup(m[path[0]], path[1:], display, namespace, found)
+}
+
+// mentionsKind reports whether a field name suggests it points at the target kind.
+func (t *refTarget) mentionsKind(key string) bool {
+	key = strings.ToLower(key)
+	if t.keyword == "service" && strings.Contains(key, "serviceaccount") {
+		return false
+	}
+	return strings.Contains(key, t.keyword)
+}
+
+// holdsName reports whether value, found in an instance in namespace, is the target name
+// or a reference object naming it, in the target's namespace.
+func (t *refTarget) holdsName(value interface{}, namespace string) bool {
+	switch value := value.(type) {
+	case string:
+		return value == t.name && namespace == t.namespace
+	case map[string]interface{}:
+		if ns, ok := value["namespace"].(string); ok && ns != "" {
+			namespace = ns
+		}
+		return value["name"] == t.name && namespace == t.namespace
+	}
+	return false
+}
+
+// runRefs implements `kgcr refs <kind>/<name>`: report custom resources whose spec
+// references a Secret, ConfigMap or Service, answering "can I delete this?".
+func runRefs(args []string) {
+	fs := flag.NewFlagSet("refs", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kgcr refs [flags] <secret|configmap|service>/[<namespace>/]<name>\n")
+		fs.PrintDefaults()
+	}
+	var sf config.Flags
+	sf.Register(fs)
+	paths := fs.String("path", "", "comma-separated extra dot paths that hold references, e.g. 'spec.backend.credentials,spec.auth.secret'")
+	positional := sf.Parse(fs, args)
+
+	if len(positional) != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	target, err := parseRefTarget(positional[0])
+	if err != nil {
+		fatal(err)
+	}
+	if *paths != "" {
+		for _, p := range strings.Split(*paths, ",") {
+			target.paths = append(target.paths, strings.Split(strings.TrimSpace(p), "."))
+		}
+	}
+
+	if target.namespace != "" && sf.Namespace != "" && sf.Namespace != target.namespace {
+		fatal(fmt.Errorf("%s is not in namespace %s given with -n", positional[0], sf.Namespace))
+	}
+	// Without -A, search the target's own namespace
+	if target.namespace != "" && !sf.AllNamespaces && sf.NamespaceRegex == "" {
+		sf.Namespace = target.namespace
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.KeepObjects = true
+	if target.namespace == "" {
+		if s.AllNamespaces {
+			fatal(fmt.Errorf("searching all namespaces needs the target's namespace, as in %s/<namespace>/%s", strings.SplitN(positional[0], "/", 2)[0], target.name))
+		}
+		target.namespace = s.Namespace
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	found := 0
+	for _, res := range allResults {
+		obj, err := res.LoadObject()
+		if err != nil {
+			fatal(err)
+		}
+		for _, path := range target.find(obj.Object, res.Namespace) {
+			if found == 0 && !sf.Quiet {
+				fmt.Fprintln(w, "NAMESPACE\tCRD\tNAME\tPATH")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", res.Namespace, res.CRDName, res.InstanceName, path)
+			found++
+		}
+	}
+	w.Flush()
+
+	if found == 0 {
+		if s.AllNamespaces {
+			say(&sf, os.Stderr, "No custom resources in any namespace reference %s\n", positional[0])
+		} else {
+			say(&sf, os.Stderr, "No custom resources reference %s in namespace: %s\n", positional[0], s.Namespace)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// secretDetector flags string values that look like inline credentials.
+type secretDetector struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// defaultSecretDetectors match well-known credential formats.
+var defaultSecretDetectors = []secretDetector{
+	{"private-key", regexp.MustCompile(`-----BEGIN ((RSA|EC|DSA|OPENSSH|ENCRYPTED) )?PRIVATE KEY-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github-token", regexp.MustCompile(`\b(ghp|gho|ghu|ghs|ghr)_[0-9A-Za-z]{36}\b|\bgithub_pat_[0-9A-Za-z_]{82}\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}\b`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[0-9A-Za-z_-]{10,}\.eyJ[0-9A-Za-z_-]{10,}\.[0-9A-Za-z_-]{10,}\b`)},
+	{"basic-auth-url", regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@]+:[^/\s:@]+@`)},
+}
+
+// sensitiveKey matches field names that usually hold a credential, such as password or apiKey.
+var sensitiveKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|api[-_]?key|access[-_]?key|private[-_]?key|credentials?)$`)
+
+// passwordKey matches fields that hold a password, which should never be set inline.
+var passwordKey = regexp.MustCompile(`(?i)^(password|passwd)$`)
+
+// secretScanner walks instance content looking for values that should live in a Secret.
+type secretScanner struct {
+	detectors []secretDetector
+
+	// entropyThreshold is the Shannon entropy (bits per character) above which a value of a
+	// sensitively named field is reported; 0 disables the check.
+	entropyThreshold float64
+	minLength        int
+}
+
+// secretFinding is a value at path that a detector matched.
+type secretFinding struct {
+	path     string
+	detector string
+}
+
+func (s *secretScanner) scan(obj map[string]interface{}) []secretFinding {
+	var findings []secretFinding
+	for _, key := range []string{"spec", "data", "stringData"} {
+		if v, ok := obj[key]; ok {
+			findings = s.walk(v, key, "", findings)
+		}
+	}
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			for key, v := range annotations {
+				// The last-applied annotation duplicates the spec, which is already scanned
+				if key == "kubectl.kubernetes.io/last-applied-configuration" {
+					continue
+				}
+				findings = s.walk(v, "metadata.annotations."+key, key, findings)
+			}
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].path < findings[j].path })
+	return findings
+}
+
+func (s *secretScanner) walk(node interface{}, path, key string, findings []secretFinding) []secretFinding {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for k, v := range node {
+			findings = s.walk(v, path+"."+k, k, findings)
+		}
+	case []interface{}:
+		for i, v := range node {
+			findings = s.walk(v, path+"["+strconv.Itoa(i)+"]", key, findings)
+		}
+	case string:
+		for _, d := range s.detectors {
+			if d.pattern.MatchString(node) {
+				return append(findings, secretFinding{path: path, detector: d.name})
+			}
+		}
+		if passwordKey.MatchString(key) && node != "" && !strings.HasPrefix(node, "$") {
+			return append(findings, secretFinding{path: path, detector: "inline-password"})
+		}
+		if s.entropyThreshold > 0 && len(node) >= s.minLength && sensitiveKey.MatchString(key) &&
+			!strings.ContainsAny(node, " \n") && shannonEntropy(node) >= s.entropyThreshold {
+			return append(findings, secretFinding{path: path, detector: "high-entropy"})
+		}
+	}
+	return findings
+}
+
+// shannonEntropy returns the entropy of value in bits per character.
+func shannonEntropy(value string) float64 {
+	counts := map[rune]int{}
+	for _, r := range value {
+		counts[r]++
+	}
+	n := float64(len([]rune(value)))
+	var entropy float64
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// detectorFlag collects repeated -pattern name=regex flags.
+type detectorFlag []secretDetector
+
+func (d *detectorFlag) String() string {
+	names := make([]string, len(*d))
+	for i, det := range *d {
+		names[i] = det.name
+	}
+	return strings.Join(names, ",")
+}
+
+func (d *detectorFlag) Set(value string) error {
+	name, expr, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=regex, got %q", value)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	*d = append(*d, secretDetector{name: name, pattern: re})
+	return nil
+}
+
+// runScanSecrets implements `kgcr scan-secrets`: flag instances that appear to embed
+// credentials inline instead of referencing a Secret. It exits with status 1 when any are found.
+func runScanSecrets(args []string) {
+	fs := flag.NewFlagSet("scan-secrets", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	var patterns detectorFlag
+	fs.Var(&patterns, "pattern", "an extra detector as name=regex; may be repeated")
+	noDefaults := fs.Bool("no-default-patterns", false, "only use the detectors given with -pattern")
+	entropy := fs.Float64("entropy", 4.0, "report values of password/token/key fields with at least this Shannon entropy (bits per character); 0 disables")
+	minLength := fs.Int("min-length", 16, "minimum value length for the entropy check")
+	sf.Parse(fs, args)
+
+	finder := &secretScanner{entropyThreshold: *entropy, minLength: *minLength}
+	if !*noDefaults {
+		finder.detectors = append(finder.detectors, defaultSecretDetectors...)
+	}
+	finder.detectors = append(finder.detectors, patterns...)
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.KeepObjects = true
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	findings := 0
+	for _, res := range allResults {
+		obj, err := res.LoadObject()
+		if err != nil {
+			fatal(err)
+		}
+		for _, f := range finder.scan(obj.Object) {
+			if findings == 0 && !sf.Quiet {
+				fmt.Fprintln(w, "NAMESPACE\tCRD\tNAME\tPATH\tDETECTOR")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", res.Namespace, res.CRDName, res.InstanceName, f.path, f.detector)
+			findings++
+		}
+	}
+	w.Flush()
+
+	if findings == 0 {
+		say(&sf, os.Stderr, "No inline credentials found in %d custom resources\n", len(allResults))
+		return
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"kgcr/internal/config"
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// clearScreen moves the cursor home and clears the terminal, so each refresh of
+// `kgcr top` replaces the last.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// topRow is one CRD in the `kgcr top` view.
+type topRow struct {
+	crd       string
+	instances int
+	start     int // instances when the watch started
+	churn     int // instances added and deleted since the start
+	latency   time.Duration
+}
+
+// sortTopRows orders rows by instances or, with byChurn, by churn, most first and ties
+// by CRD name.
+func sortTopRows(rows []topRow, byChurn bool) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if byChurn && a.churn != b.churn {
+			return a.churn > b.churn
+		}
+		if a.instances != b.instances {
+			return a.instances > b.instances
+		}
+		return a.crd < b.crd
+	})
+}
+
+// runTop implements `kgcr top`: watch every CRD's instances and redraw, every -interval,
+// their count, change since the start and churn, and how long the initial list took,
+// to watch while load-testing an operator or draining a cluster.
+func runTop(args []string) {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	interval := fs.Duration("interval", 5*time.Second, "time between refreshes of the view")
+	sortBy := fs.String("sort-by", "count", "sort the CRDs by count (instances) or churn (instances added and deleted since the start)")
+	iterations := fs.Int("iterations", 0, "stop after this many refreshes; 0 runs until interrupted")
+	sf.Parse(fs, args)
+	if *sortBy != "count" && *sortBy != "churn" {
+		fatal(fmt.Errorf("invalid -sort-by %q: must be count or churn", *sortBy))
+	}
+	if *interval <= 0 {
+		fatal(fmt.Errorf("invalid -interval %s: must be positive", *interval))
+	}
+	if sf.ListStrategy == "per-namespace" {
+		fatal(errors.New("kgcr top keeps one cluster-wide watch per resource type and cannot be used with -list-strategy per-namespace"))
+	}
+	if sf.Incremental {
+		fatal(errors.New("kgcr top keeps its counts current itself and cannot be used with -incremental"))
+	}
+	// Like top, watch the whole cluster unless -n narrows it
+	if sf.Namespace == "" {
+		sf.AllNamespaces = true
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The informers keep the counts current through watches, so refreshing the view
+	// costs no API requests. Events wait for mu until the initial counts are in.
+	var mu sync.Mutex
+	mu.Lock()
+	rows := map[string]*topRow{}
+	row := func(crd string) *topRow {
+		r := rows[crd]
+		if r == nil {
+			r = &topRow{crd: crd}
+			rows[crd] = r
+		}
+		return r
+	}
+	allResults, err := s.Watch(ctx, sf.Timeout, func(ev scan.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		r := row(ev.Result.CRDName)
+		switch ev.Type {
+		case scan.Added:
+			r.instances++
+			r.churn++
+		case scan.Deleted:
+			r.instances--
+			r.churn++
+		}
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		say(&sf, os.Stderr, "No namespaced custom resources found in cluster\n")
+		return
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	// CRDs that could not be listed are left out rather than shown as empty
+	failed := map[string]bool{}
+	for _, p := range s.Stats.ListFailures {
+		failed[p.CRD] = true
+	}
+	for _, crd := range s.CRDs {
+		if !failed[crd.Name] {
+			row(crd.Name)
+		}
+	}
+	for _, res := range allResults {
+		row(res.CRDName).instances++
+	}
+	for crd, r := range rows {
+		r.start = r.instances
+		r.latency = s.Stats.Latencies[crd]
+	}
+	mu.Unlock()
+
+	// Clear the screen between refreshes only on a terminal; piped output keeps them all
+	redraw := output.IsTerminal(os.Stdout)
+	began := time.Now()
+	for i := 0; *iterations == 0 || i < *iterations; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(*interval):
+			}
+		}
+
+		mu.Lock()
+		view := make([]topRow, 0, len(rows))
+		total := 0
+		for _, r := range rows {
+			view = append(view, *r)
+			total += r.instances
+		}
+		mu.Unlock()
+		sortTopRows(view, *sortBy == "churn")
+
+		if redraw {
+			fmt.Fprint(os.Stdout, clearScreen)
+		}
+		if !sf.Quiet {
+			fmt.Fprintf(os.Stdout, "kgcr top - %s - %s, every %s since %s - %d instances of %d CRDs, initial sync took %s\n\n",
+				s.Cluster, time.Now().Format(time.TimeOnly), *interval, began.Format(time.TimeOnly),
+				total, len(view), s.Stats.WallTime.Round(time.Millisecond))
+		}
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		if !sf.Quiet {
+			fmt.Fprintln(w, "CRD\tINSTANCES\tSINCE START\tCHURN\tLATENCY")
+		}
+		for _, r := range view {
+			delta := "0"
+			if r.instances != r.start {
+				delta = fmt.Sprintf("%+d", r.instances-r.start)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\n", r.crd, r.instances, delta, r.churn, r.latency.Round(time.Millisecond))
+		}
+		w.Flush()
+		if !redraw {
+			fmt.Fprintln(os.Stdout)
+		}
+	}
+}
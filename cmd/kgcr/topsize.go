@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"kgcr/internal/config"
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// runTopSize implements `kgcr top-size`: list the largest custom resources, since oversized
+// objects are a frequent cause of etcd and watch-cache problems.
+func runTopSize(args []string) {
+	fs := flag.NewFlagSet("top-size", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	limit := fs.Int("limit", 20, "how many of the largest custom resources to list")
+	sf.Parse(fs, args)
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.ComputeSize = true
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+	if len(allResults) == 0 {
+		say(&sf, os.Stderr, "No custom resources found\n")
+		return
+	}
+
+	sort.SliceStable(allResults, func(i, j int) bool {
+		return allResults[i].Size > allResults[j].Size
+	})
+	if *limit > 0 && len(allResults) > *limit {
+		allResults = allResults[:*limit]
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	if !sf.Quiet {
+		fmt.Fprintln(w, "SIZE\tNAMESPACE\tCRD\tNAME")
+	}
+	for _, res := range allResults {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", output.FormatSize(res.Size, s.SizeWarning), res.Namespace, res.CRDName, res.InstanceName)
+	}
+	w.Flush()
+}
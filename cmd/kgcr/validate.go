@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+
+	"kgcr/internal/config"
+	"kgcr/internal/scan"
+)
+
+// schemaValidator checks instances against one CRD version's OpenAPI v3 schema the way the
+// API server would on create or update: OpenAPI validation (types, required, enum, formats),
+// x-kubernetes-validations CEL rules, and fields the structural schema would prune.
+type schemaValidator struct {
+	openAPI    validation.SchemaValidator
+	structural *structuralschema.Structural
+	cel        *cel.Validator // nil when the schema has no CEL rules
+}
+
+// newSchemaValidator builds a validator for version of crd, or returns nil if it has no schema.
+func newSchemaValidator(crd *apiextensionsv1.CustomResourceDefinition, version string) (*schemaValidator, error) {
+	var v1Schema *apiextensionsv1.JSONSchemaProps
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version && v.Schema != nil {
+			v1Schema = v.Schema.OpenAPIV3Schema
+		}
+	}
+	if v1Schema == nil {
+		return nil, nil
+	}
+
+	internalSchema := &apiextensions.JSONSchemaProps{}
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(v1Schema, internalSchema, nil); err != nil {
+		return nil, fmt.Errorf("converting schema: %w", err)
+	}
+	openAPI, _, err := validation.NewSchemaValidator(internalSchema)
+	if err != nil {
+		return nil, fmt.Errorf("building OpenAPI validator: %w", err)
+	}
+	structural, err := structuralschema.NewStructural(internalSchema)
+	if err != nil {
+		return nil, fmt.Errorf("schema is not structural: %w", err)
+	}
+	return &schemaValidator{
+		openAPI:    openAPI,
+		structural: structural,
+		cel:        cel.NewValidator(structural, true, celconfig.PerCallLimit),
+	}, nil
+}
+
+// validate returns one message per problem found in obj.
+func (v *schemaValidator) validate(ctx context.Context, obj *unstructured.Unstructured) []string {
+	var problems []string
+
+	errs := validation.ValidateCustomResource(nil, obj.UnstructuredContent(), v.openAPI)
+	if v.cel != nil {
+		celErrs, _ := v.cel.Validate(ctx, nil, v.structural, obj.Object, nil, celconfig.RuntimeCELCostBudget)
+		errs = append(errs, celErrs...)
+	}
+	for _, err := range errs {
+		problems = append(problems, err.Error())
+	}
+
+	// Pruning mutates its input, so work on a copy
+	unknown := pruning.PruneWithOptions(runtime.DeepCopyJSON(obj.Object), v.structural, true, structuralschema.UnknownFieldPathOptions{TrackUnknownFieldPaths: true})
+	for _, path := range unknown {
+		problems = append(problems, fmt.Sprintf("%s: unknown field, would be pruned on update", path))
+	}
+	return problems
+}
+
+// prober sends no-op server-side dry-run patches to a sample of each CRD's instances, so
+// the API server runs the whole update path: conversion, defaulting, admission webhooks
+// and validation. It catches what schema checks alone cannot, such as a conversion or
+// admission webhook that is down or rejects objects it accepted before.
+type prober struct {
+	s      *scan.Scanner
+	sample int
+	// probed counts the instances probed per CRD; skipped are the CRDs that cannot be
+	// probed at all, skipped after one warning and left out of probed
+	probed  map[string]int
+	skipped map[string]bool
+}
+
+// skippedCRDs returns the CRDs that could not be probed, sorted.
+func (p *prober) skippedCRDs() []string {
+	crds := make([]string, 0, len(p.skipped))
+	for crd := range p.skipped {
+		crds = append(crds, crd)
+	}
+	sort.Strings(crds)
+	return crds
+}
+
+// probe returns why a dry-run update of res was rejected, or "" if it was accepted or
+// not probed.
+func (p *prober) probe(ctx context.Context, res *scan.Result) string {
+	if p.skipped[res.CRDName] || p.probed[res.CRDName] >= p.sample {
+		return ""
+	}
+	p.probed[res.CRDName]++
+	// An empty merge patch changes nothing, but still goes through every update step
+	_, err := p.s.DynamicClient.Resource(res.GVR).Namespace(res.Namespace).Patch(ctx, res.InstanceName, types.MergePatchType, []byte("{}"),
+		metav1.PatchOptions{DryRun: []string{metav1.DryRunAll}})
+	switch {
+	case err == nil, apierrors.IsNotFound(err):
+		return ""
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err), apierrors.IsMethodNotSupported(err):
+		slog.Warn("cannot probe CRD", "crd", res.CRDName, "error", err)
+		p.skipped[res.CRDName] = true
+		delete(p.probed, res.CRDName)
+		return ""
+	}
+	return "dry-run update rejected: " + err.Error()
+}
+
+// runValidate implements `kgcr validate`: validate every instance against its CRD's schema
+// and report the ones that would be rejected (or lose fields) on their next update.
+// With -probe, a sample of each CRD's instances also gets a server-side dry-run update.
+// It exits with status 1 when any are found.
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	var sf config.Flags
+	sf.Register(fs)
+	probe := fs.Bool("probe", false, "also send a no-op server-side dry-run patch to a sample of each CRD's instances, catching broken conversion or admission webhooks before an upgrade does; needs patch permission")
+	probeSample := fs.Int("probe-sample", 3, "with -probe, the number of instances of each CRD to probe")
+	sf.Parse(fs, args)
+	if *probe && sf.Offline() {
+		fatal(errors.New("-probe needs a cluster and cannot be used with -from-dir or -from-dump"))
+	}
+	if *probeSample < 1 {
+		fatal(fmt.Errorf("invalid -probe-sample %d: must be at least 1", *probeSample))
+	}
+
+	s, err := sf.NewScanner()
+	if err != nil {
+		fatal(err)
+	}
+	s.KeepObjects = true
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancel()
+
+	allResults, err := s.Scan(ctx)
+	if err != nil && !errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		fatal(err)
+	}
+
+	// Build each CRD's validator once, on first use
+	validators := map[string]*schemaValidator{}
+	var p *prober
+	if *probe {
+		p = &prober{s: s, sample: *probeSample, probed: map[string]int{}, skipped: map[string]bool{}}
+	}
+	// The scan may have used up most of -timeout, so the probes get a deadline of their own.
+	probeCtx, cancelProbe := context.WithTimeout(context.Background(), sf.Timeout)
+	defer cancelProbe()
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	invalid := 0
+	for _, res := range allResults {
+		// Aggregated API resources have no CRD schema to validate against
+		if res.CRD == nil {
+			continue
+		}
+		v, ok := validators[res.CRDName]
+		if !ok {
+			v, err = newSchemaValidator(res.CRD, res.GVR.Version)
+			if err != nil {
+				slog.Warn("skipping CRD whose schema cannot be validated against", "crd", res.CRDName, "error", err)
+			}
+			validators[res.CRDName] = v
+		}
+
+		var problems []string
+		if v != nil {
+			obj, err := res.LoadObject()
+			if err != nil {
+				fatal(err)
+			}
+			problems = v.validate(context.Background(), obj)
+		}
+		if p != nil {
+			if rejected := p.probe(probeCtx, &res); rejected != "" {
+				problems = append(problems, rejected)
+			}
+		}
+		if len(problems) == 0 {
+			continue
+		}
+		if invalid == 0 && !sf.Quiet {
+			fmt.Fprintln(w, "NAMESPACE\tCRD\tNAME\tPROBLEM")
+		}
+		for _, p := range problems {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", res.Namespace, res.CRDName, res.InstanceName, p)
+		}
+		invalid++
+	}
+	w.Flush()
+
+	if p != nil && len(p.skipped) > 0 {
+		say(&sf, os.Stderr, "%d CRDs could not be probed: %s\n", len(p.skipped), strings.Join(p.skippedCRDs(), ", "))
+	}
+	if invalid == 0 {
+		say(&sf, os.Stderr, "All %d custom resources are valid against their CRD schemas\n", len(allResults))
+		if p != nil && len(p.probed) > 0 {
+			say(&sf, os.Stderr, "Probed instances of %d CRDs with a dry-run update, and all were accepted\n", len(p.probed))
+		}
+		return
+	}
+	if p != nil {
+		say(&sf, os.Stderr, "%d of %d custom resources do not match their CRD schemas or were rejected by a dry-run update\n", invalid, len(allResults))
+		os.Exit(1)
+	}
+	say(&sf, os.Stderr, "%d of %d custom resources do not match their CRD schemas\n", invalid, len(allResults))
+	os.Exit(1)
+}
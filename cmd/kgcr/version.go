@@ -0,0 +1,168 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"text/tabwriter"
+	"time"
+
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+)
+
+// commit and date are set by release builds with -ldflags "-X main.commit=... -X main.date=...".
+// Builds from source without them fall back to the VCS information Go embeds.
+var (
+	commit = ""
+	date   = ""
+)
+
+// latestReleaseURL is the GitHub API endpoint for the newest kgcr release.
+const latestReleaseURL = "https://api.github.com/repos/itsrishub/kgcr/releases/latest"
+
+// buildInfo is what `kgcr version` reports about the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+
+	// Latest, LatestURL and UpdateAvailable are only set with -check
+	Latest          string `json:"latest,omitempty"`
+	LatestURL       string `json:"latestURL,omitempty"`
+	UpdateAvailable *bool  `json:"updateAvailable,omitempty"`
+}
+
+// currentBuild returns the build information of the running binary: the version, commit
+// and date set at link time or, for a `go build` from a git checkout, the commit and
+// commit time Go records, marked "-dirty" if the tree had local changes.
+func currentBuild() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && info.Commit == "" {
+		modified := false
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	return info
+}
+
+// latestRelease asks GitHub for the newest kgcr release and returns its tag and page.
+func latestRelease(ctx context.Context) (tag, url string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	// Anonymous requests share a small hourly limit per IP address, tight behind a NAT
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("checking for a newer release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("checking for a newer release: GitHub answered %s", resp.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", "", fmt.Errorf("checking for a newer release: %w", err)
+	}
+	return release.TagName, release.HTMLURL, nil
+}
+
+// newerThan reports whether the release tagged latest is newer than current. A current
+// version that is not semantic, such as "dev", is never up to date.
+func newerThan(latest, current string) (bool, error) {
+	l, err := utilversion.ParseSemantic(latest)
+	if err != nil {
+		return false, fmt.Errorf("parsing latest release %q: %w", latest, err)
+	}
+	c, err := utilversion.ParseSemantic(current)
+	if err != nil {
+		return true, nil
+	}
+	return c.LessThan(l), nil
+}
+
+// runVersion implements `kgcr version`: print the version, commit and build date of this
+// binary and, with -check, whether a newer release is out, to tell which build runs where.
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	check := fs.Bool("check", false, "also ask GitHub whether a newer release is available; set GITHUB_TOKEN to raise the API rate limit")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for -check")
+	format := fs.String("o", "table", "output format: table or json")
+	fs.Parse(args)
+	if *format != "table" && *format != "json" {
+		fatal(fmt.Errorf("invalid -o %q: must be table or json", *format))
+	}
+
+	info := currentBuild()
+	if *check {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		tag, url, err := latestRelease(ctx)
+		if err != nil {
+			fatal(err)
+		}
+		newer, err := newerThan(tag, info.Version)
+		if err != nil {
+			fatal(err)
+		}
+		info.Latest, info.LatestURL, info.UpdateAvailable = tag, url, &newer
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(info); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "Version:\t%s\n", info.Version)
+	fmt.Fprintf(w, "Commit:\t%s\n", cmp.Or(info.Commit, "unknown"))
+	fmt.Fprintf(w, "Built:\t%s\n", cmp.Or(info.Date, "unknown"))
+	fmt.Fprintf(w, "Go version:\t%s\n", info.GoVersion)
+	fmt.Fprintf(w, "Platform:\t%s\n", info.Platform)
+	if info.UpdateAvailable != nil {
+		if *info.UpdateAvailable {
+			fmt.Fprintf(w, "Latest release:\t%s, a newer version is available: %s\n", info.Latest, info.LatestURL)
+		} else {
+			fmt.Fprintf(w, "Latest release:\t%s, up to date\n", info.Latest)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"kgcr/internal/config"
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// watchList implements -watch: a line for every instance added, modified or deleted until
+// interrupted, starting with an ADDED line for each instance found, so the lines alone
+// can be tailed as a change feed. Informers keep the inventory current through watches,
+// so after the initial list the API server does next to no work.
+func watchList(s *scan.Scanner, sf *config.Flags, out io.Writer, format string, clean bool, columns []output.Column, opts *output.Options, sortBy string, reverse bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Events wait here until the initial instances are printed
+	events := make(chan scan.Event, 100)
+	results, err := s.Watch(ctx, sf.Timeout, func(ev scan.Event) {
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+		}
+	})
+	if errors.Is(err, scan.ErrNoNamespacedCRDs) {
+		say(sf, os.Stderr, "No namespaced custom resources found in cluster\n")
+		return
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	scan.SortResults(results, sortBy, reverse)
+	now := time.Now()
+	initial := make([]scan.Event, len(results))
+	for i := range results {
+		initial[i] = scan.Event{Type: scan.Added, Time: now, Result: results[i]}
+	}
+	printer := output.NewEventPrinter(columns, opts)
+	write := func(events []scan.Event) {
+		if format != "json" {
+			printer.Print(out, events)
+			return
+		}
+		for i := range events {
+			if err := output.WriteEventJSON(out, &events[i], clean); err != nil {
+				fatal(err)
+			}
+		}
+	}
+	write(initial)
+	if len(results) == 0 {
+		say(sf, os.Stderr, "Watching for custom resources...\n")
+	}
+
+	for {
+		select {
+		case ev := <-events:
+			write([]scan.Event{ev})
+		case <-ctx.Done():
+			return
+		}
+	}
+}
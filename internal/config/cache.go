@@ -0,0 +1,60 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/homedir"
+)
+
+// defaultCacheDir is kubectl's cache directory: KUBECACHEDIR, or ~/.kube/cache.
+func defaultCacheDir() string {
+	if dir := os.Getenv("KUBECACHEDIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(homedir.HomeDir(), ".kube", "cache")
+}
+
+// overlyCautiousIllegalFileCharacters matches the characters kubectl replaces in a host
+// name to build its discovery cache path.
+var overlyCautiousIllegalFileCharacters = regexp.MustCompile(`[^(\w/.)]`)
+
+// discoveryCacheDir returns the directory kubectl caches discovery data for host in, so
+// that kgcr and kubectl share it, e.g. ~/.kube/cache/discovery/api.example.com_6443.
+func discoveryCacheDir(cacheDir, host string) string {
+	schemelessHost := strings.Replace(strings.Replace(host, "https://", "", 1), "http://", "", 1)
+	safeHost := overlyCautiousIllegalFileCharacters.ReplaceAllString(schemelessHost, "_")
+	return filepath.Join(cacheDir, "discovery", safeHost)
+}
+
+// unsafeNameCharacters matches the characters replaced in a context name to use it as a
+// directory name, such as the "/" and ":" of EKS context ARNs.
+var unsafeNameCharacters = regexp.MustCompile(`[^\w.-]`)
+
+// incrementalStateDir returns the directory under the discovery cache directory dir that
+// keeps the -incremental lists of one identity. Contexts and users with different RBAC see
+// different instances, so each gets its own, named after the context with a hash of the
+// context, kubeconfig user and credentials, e.g. kgcr-incremental/prod-3f2a9c01b7d4.
+func incrementalStateDir(dir, contextName, authInfo string, config *rest.Config) string {
+	h := sha256.New()
+	parts := []string{contextName, authInfo, config.Username, config.BearerToken, config.BearerTokenFile,
+		config.CertFile, string(config.CertData), config.Impersonate.UserName}
+	if config.ExecProvider != nil {
+		parts = append(parts, config.ExecProvider.Command)
+		parts = append(parts, config.ExecProvider.Args...)
+	}
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	name := hex.EncodeToString(h.Sum(nil))[:12]
+	if contextName != "" {
+		name = unsafeNameCharacters.ReplaceAllString(contextName, "_") + "-" + name
+	}
+	return filepath.Join(dir, "kgcr-incremental", name)
+}
@@ -0,0 +1,460 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery/cached/disk"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"kgcr/internal/output"
+	"kgcr/internal/scan"
+)
+
+// Flags are the flags shared by every command that scans the cluster for custom resources.
+type Flags struct {
+	Kubeconfig            string
+	Server                string
+	Token                 string
+	TokenFile             string
+	CertificateAuthority  string
+	ClientCertificate     string
+	ClientKey             string
+	InsecureSkipTLSVerify bool
+	Context               string
+	Namespace             string
+	AllNamespaces         bool
+	NamespaceRegex        string
+	Timeout               time.Duration
+	ServerTimeout         time.Duration
+	FromCache             bool
+	QPS                   float64
+	Burst                 int
+	WaitEstablished       time.Duration
+	ChunkSize             int64
+	LimitPerCRD           int64
+	ListStrategy          string
+	Incremental           bool
+	Quiet                 bool
+	ShowWarnings          bool
+	Progress              bool
+	CacheDir              string
+	FromDir               string
+	FromDump              string
+	Annotations           []string // key=value pairs every instance must carry
+	HasAnnotations        []string // keys every instance must carry
+	SuspendedOnly         bool
+	CELExpression         string
+	JQExpression          string
+	JQMode                string
+	SizeWarning           string
+	NearLimit             bool
+	ByKind                string
+	Verbosity             int
+	Debug                 bool
+	Stats                 bool
+	OTelEndpoint          string
+	PprofAddr             string
+	CPUProfile            string
+	MemProfile            string
+	LogFormat             string
+	Category              string
+	CRDSelector           string
+	Operator              string
+	Source                string
+}
+
+// Register adds the shared flags to fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Quiet, "q", false, "quiet: print only result rows, without headers, warnings or messages such as 'No custom resources found'; use the exit status")
+	fs.BoolVar(&f.Quiet, "quiet", false, "quiet: print only result rows, without headers, warnings or messages such as 'No custom resources found'; use the exit status")
+	fs.BoolVar(&f.Progress, "progress", true, "show a live 'scanned 143/312 CRDs' line on stderr while scanning, when stderr is a terminal; -progress=false turns it off")
+	fs.IntVar(&f.Verbosity, "v", 0, "log verbosity from 0 (warnings and errors) to 4 (everything); logs always go to stderr")
+	fs.StringVar(&f.LogFormat, "log-format", "text", "log format: text or json")
+	fs.BoolVar(&f.Stats, "stats", false, "print a scan summary to stderr: CRDs scanned and skipped, instances, API requests, throttling, wall time, peak concurrency and API server warnings")
+	fs.BoolVar(&f.ShowWarnings, "show-warnings", false, "log the warnings the API server returned, such as deprecated versions or admission webhook warnings, once per CRD and warning")
+	fs.StringVar(&f.OTelEndpoint, "otel-endpoint", "", "send OpenTelemetry traces over OTLP/HTTP to this endpoint, e.g. localhost:4318, with a span per scan phase and CRD list call")
+	fs.StringVar(&f.PprofAddr, "pprof", "", "serve net/http/pprof profiles on this address while kgcr runs, e.g. ':6060'")
+	fs.StringVar(&f.CPUProfile, "cpuprofile", "", "write a CPU profile of the scan to this file")
+	fs.StringVar(&f.MemProfile, "memprofile", "", "write a heap profile to this file after the scan")
+	fs.BoolVar(&f.Debug, "debug", false, "print per-CRD list latency, item count, retries and errors to stderr after the scan, slowest first")
+	fs.StringVar(&f.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file. If not specified, KUBECONFIG or ~/.kube/config is used.")
+	fs.StringVar(&f.Context, "context", "", "the kubeconfig context to use. If not specified, the current context is used.")
+	fs.StringVar(&f.Server, "server", "", "the address of the Kubernetes API server, overriding the kubeconfig; with -token or -token-file, no kubeconfig is needed")
+	fs.StringVar(&f.Token, "token", "", "bearer token for authentication to the API server")
+	fs.StringVar(&f.TokenFile, "token-file", "", "file holding a bearer token for authentication to the API server, re-read as it changes")
+	fs.StringVar(&f.CertificateAuthority, "certificate-authority", "", "path to a CA certificate file to verify the API server's certificate")
+	fs.StringVar(&f.ClientCertificate, "client-certificate", "", "path to a client certificate file for TLS authentication to the API server")
+	fs.StringVar(&f.ClientKey, "client-key", "", "path to the key file of -client-certificate")
+	fs.BoolVar(&f.InsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "do not verify the API server's certificate; this makes the connection insecure")
+	fs.StringVar(&f.Namespace, "n", "", "the namespace to scan for custom resources. If not specified, the current context's namespace is used.")
+	fs.StringVar(&f.Namespace, "namespace", "", "the namespace to scan for custom resources. If not specified, the current context's namespace is used.")
+	fs.BoolVar(&f.AllNamespaces, "A", false, "scan all namespaces")
+	fs.BoolVar(&f.AllNamespaces, "all-namespaces", false, "scan all namespaces")
+	fs.StringVar(&f.NamespaceRegex, "namespace-regex", "", "only scan the namespaces whose names match this regular expression, e.g. '^team-.*-prod$'; implies -A")
+	fs.StringVar(&f.FromDir, "from-dir", "", "scan the manifests under this directory instead of a cluster: kgcr or kubectl exports, or an extracted Velero backup")
+	fs.StringVar(&f.FromDump, "from-dump", "", "scan a cluster dump instead of a cluster: a support-bundle .tar.gz or directory, or the output of 'kubectl cluster-info dump'")
+	fs.StringVar(&f.CacheDir, "cache-dir", defaultCacheDir(), "kubectl's cache directory; the CRD list and discovery data are cached under its discovery directory. Empty disables caching.")
+	fs.DurationVar(&f.Timeout, "timeout", 30*time.Second, "timeout for the operation")
+	fs.BoolVar(&f.FromCache, "from-cache", false, "list from the API server's watch cache (resourceVersion=0) instead of reading from etcd: much cheaper on large clusters, but results may be slightly stale")
+	fs.DurationVar(&f.ServerTimeout, "server-timeout", 0, "ask the API server to end each list call after this long (ListOptions.timeoutSeconds), so it bounds expensive lists itself under load; 0 uses the server's default")
+	fs.Float64Var(&f.QPS, "qps", 100, "maximum API requests per second; lower it for fragile managed control planes, raise it for large ones")
+	fs.IntVar(&f.Burst, "burst", 200, "maximum burst of API requests above -qps")
+	fs.DurationVar(&f.WaitEstablished, "wait-established", 0, "wait up to this long for CRDs that are not yet Established, e.g. right after an operator install; by default they are skipped and reported as problems")
+	fs.Int64Var(&f.LimitPerCRD, "limit-per-crd", 0, "list at most this many instances per CRD, followed by a '... and N more' row; 0 lists all")
+	fs.StringVar(&f.ListStrategy, "list-strategy", "cluster", "how -A scans list each resource type: cluster (one cluster-wide list) or per-namespace (one list per namespace, several at once, for clusters where cluster-wide lists of huge CRDs time out)")
+	fs.BoolVar(&f.Incremental, "incremental", false, "keep the instances listed under -cache-dir and, on the next run, fetch only what changed since by watching from their resourceVersions; resource types are listed in full the first time or when the changes are older than the API server keeps. The files hold full copies of the instances, including any credentials in their specs, and each resource type being listed is held in memory whole")
+	fs.Int64Var(&f.ChunkSize, "chunk-size", 500, "list instances in pages of this size to bound memory use on large clusters; 0 lists each resource type in one call")
+	fs.Func("annotation", "only list instances whose annotation has this value, as key=value, e.g. 'argocd.argoproj.io/sync-options=Prune=false'; may be repeated", func(value string) error {
+		if key, _, ok := strings.Cut(value, "="); !ok || key == "" {
+			return fmt.Errorf("expected key=value, got %q", value)
+		}
+		f.Annotations = append(f.Annotations, value)
+		return nil
+	})
+	fs.Func("has-annotation", "only list instances that have this annotation, whatever its value; may be repeated", func(key string) error {
+		if key == "" {
+			return errors.New("expected an annotation key")
+		}
+		f.HasAnnotations = append(f.HasAnnotations, key)
+		return nil
+	})
+	fs.BoolVar(&f.SuspendedOnly, "suspended-only", false, "only list instances whose reconciliation is paused by spec.suspend, spec.paused or a Flux, Argo CD, Crossplane, KEDA or Cluster API pause annotation")
+	fs.StringVar(&f.CELExpression, "cel", "", "only list instances for which this CEL expression is true, e.g. 'object.spec.replicas > 3'")
+	fs.StringVar(&f.JQExpression, "jq", "", "jq expression evaluated against each instance, e.g. '.spec.source.repoURL'")
+	fs.StringVar(&f.JQMode, "jq-mode", "filter", "how to use the -jq expression: 'filter' keeps instances with a truthy result, 'column' adds a JQ column with the result")
+	fs.StringVar(&f.SizeWarning, "size-warning", "1Mi", "serialized size at which an instance is marked WARNING as approaching the ~1.5MiB API server request limit")
+	fs.BoolVar(&f.NearLimit, "near-limit", false, "only list instances at or above the -size-warning threshold")
+	fs.StringVar(&f.Source, "source", "crd", "where to find resource types: 'crd' lists CustomResourceDefinitions, 'discovery' also includes resources served by aggregated API servers")
+	fs.StringVar(&f.CRDSelector, "crd-selector", "", "label selector applied to the CRDs themselves, e.g. 'app.kubernetes.io/part-of=cert-manager'")
+	fs.StringVar(&f.Operator, "operator", "", "only scan the CRDs owned by this OLM ClusterServiceVersion, e.g. 'etcdoperator.v0.9.4'")
+	fs.StringVar(&f.Category, "category", "", "only scan CRDs whose spec.names.categories include this category, e.g. 'all'")
+	fs.StringVar(&f.ByKind, "by-kind", "", "comma-separated Kinds to scan, e.g. Certificate,Kafka (case-insensitive); Kind.group, e.g. Certificate.cert-manager.io, picks one of several groups sharing a Kind")
+}
+
+// NewScanner compiles the instance filters and builds the API clients, for the cluster in
+// the kubeconfig or, with -from-dir or -from-dump, for manifests on disk.
+func (f *Flags) NewScanner() (*scan.Scanner, error) {
+	s := &scan.Scanner{
+		AllNamespaces:   f.AllNamespaces,
+		Category:        f.Category,
+		Operator:        f.Operator,
+		Debug:           f.Debug,
+		PrintStats:      f.Stats,
+		CPUProfile:      f.CPUProfile,
+		MemProfile:      f.MemProfile,
+		Metrics:         scan.NewAPIMetrics(),
+		Warnings:        scan.NewWarningRecorder(),
+		ShowWarnings:    f.ShowWarnings,
+		ChunkSize:       f.ChunkSize,
+		LimitPerCRD:     f.LimitPerCRD,
+		PerNamespace:    f.ListStrategy == "per-namespace",
+		ServerTimeout:   f.ServerTimeout,
+		FromCache:       f.FromCache,
+		WaitEstablished: f.WaitEstablished,
+		// Log lines would break up the progress line, so it only shows without -v
+		Progress: f.Progress && !f.Quiet && f.Verbosity == 0 && output.IsTerminal(os.Stderr),
+		// Objects kept for inspection or -o json are spilled to disk rather than held in memory
+		Spool: scan.NewSpool(""),
+	}
+	if f.ChunkSize < 0 {
+		return nil, fmt.Errorf("invalid -chunk-size %d: must not be negative", f.ChunkSize)
+	}
+	if f.LimitPerCRD < 0 {
+		return nil, fmt.Errorf("invalid -limit-per-crd %d: must not be negative", f.LimitPerCRD)
+	}
+	if f.ListStrategy != "cluster" && f.ListStrategy != "per-namespace" {
+		return nil, fmt.Errorf("invalid -list-strategy %q: must be cluster or per-namespace", f.ListStrategy)
+	}
+	if f.ListStrategy == "per-namespace" && f.LimitPerCRD > 0 {
+		return nil, errors.New("-list-strategy per-namespace lists namespaces in parallel and cannot be used with -limit-per-crd")
+	}
+	if f.Incremental && (f.LimitPerCRD > 0 || f.ListStrategy == "per-namespace") {
+		return nil, errors.New("-incremental keeps every instance of each resource type and cannot be used with -limit-per-crd or -list-strategy per-namespace")
+	}
+	if f.Incremental && (f.CacheDir == "" || f.Offline()) {
+		return nil, errors.New("-incremental keeps its state under -cache-dir and needs a cluster: it cannot be used with an empty -cache-dir, -from-dir or -from-dump")
+	}
+	if f.ServerTimeout < 0 {
+		return nil, fmt.Errorf("invalid -server-timeout %s: must not be negative", f.ServerTimeout)
+	}
+	if f.QPS <= 0 {
+		return nil, fmt.Errorf("invalid -qps %g: must be positive", f.QPS)
+	}
+	if f.Burst <= 0 {
+		return nil, fmt.Errorf("invalid -burst %d: must be positive", f.Burst)
+	}
+
+	// Compile instance filters up front so a bad expression fails before any API calls.
+	// The cheap annotation filters go first, sparing CEL and jq the instances they reject.
+	for _, annotation := range f.Annotations {
+		key, value, _ := strings.Cut(annotation, "=")
+		s.Filters = append(s.Filters, scan.NewAnnotationFilter(key, value))
+	}
+	for _, key := range f.HasAnnotations {
+		s.Filters = append(s.Filters, scan.NewHasAnnotationFilter(key))
+	}
+	if f.SuspendedOnly {
+		s.Filters = append(s.Filters, scan.NewSuspendedFilter())
+	}
+	if f.CELExpression != "" {
+		cf, err := scan.NewCELFilter(f.CELExpression)
+		if err != nil {
+			return nil, fmt.Errorf("parsing -cel expression: %w", err)
+		}
+		s.Filters = append(s.Filters, cf)
+	}
+	if f.JQExpression != "" {
+		q, err := scan.NewJQQuery(f.JQExpression)
+		if err != nil {
+			return nil, fmt.Errorf("parsing -jq expression: %w", err)
+		}
+		switch f.JQMode {
+		case "filter":
+			s.Filters = append(s.Filters, q)
+		case "column":
+			s.JQColumn = q
+		default:
+			return nil, fmt.Errorf("invalid -jq-mode %q: must be 'filter' or 'column'", f.JQMode)
+		}
+	}
+
+	if f.ByKind != "" {
+		s.Kinds = map[string]bool{}
+		for _, kind := range strings.Split(f.ByKind, ",") {
+			s.Kinds[strings.ToLower(strings.TrimSpace(kind))] = true
+		}
+	}
+
+	if f.NamespaceRegex != "" {
+		if f.Namespace != "" {
+			return nil, errors.New("-namespace-regex and -n cannot be used together")
+		}
+		re, err := regexp.Compile(f.NamespaceRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -namespace-regex %q: %w", f.NamespaceRegex, err)
+		}
+		s.NamespaceRegex = re
+		// The matching namespaces are picked from all of them
+		f.AllNamespaces, s.AllNamespaces = true, true
+	}
+
+	if f.CRDSelector != "" {
+		if _, err := labels.Parse(f.CRDSelector); err != nil {
+			return nil, fmt.Errorf("invalid -crd-selector %q: %w", f.CRDSelector, err)
+		}
+		s.CRDSelector = f.CRDSelector
+	}
+
+	switch f.Source {
+	case "crd":
+	case "discovery":
+		s.Discovery = true
+	default:
+		return nil, fmt.Errorf("invalid -source %q: must be 'crd' or 'discovery'", f.Source)
+	}
+
+	sizeWarning, err := resource.ParseQuantity(f.SizeWarning)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -size-warning %q: %w", f.SizeWarning, err)
+	}
+	s.SizeWarning = int(sizeWarning.Value())
+	s.NearLimitOnly = f.NearLimit
+	s.ComputeSize = f.NearLimit
+
+	if f.PprofAddr != "" {
+		servePprof(f.PprofAddr)
+	}
+
+	if f.OTelEndpoint != "" {
+		s.TracerProvider, err = scan.SetupTracing(context.Background(), f.OTelEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Offline() {
+		err = f.loadOffline(s)
+	} else {
+		err = f.connect(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// kubeconfigSources describes where loadingRules looked for a kubeconfig, e.g.
+// "KUBECONFIG (a.yaml, b.yaml)" or "/home/me/.kube/config".
+func kubeconfigSources(loadingRules *clientcmd.ClientConfigLoadingRules) string {
+	files := strings.Join(loadingRules.GetLoadingPrecedence(), ", ")
+	switch {
+	case loadingRules.ExplicitPath != "":
+		return loadingRules.ExplicitPath
+	case os.Getenv(clientcmd.RecommendedConfigPathEnvVar) != "":
+		return clientcmd.RecommendedConfigPathEnvVar + " (" + files + ")"
+	}
+	return files
+}
+
+// connect loads the kubeconfig, resolves the namespace to scan and builds the API clients.
+func (f *Flags) connect(s *scan.Scanner) error {
+	// Same loading rules as kubectl: -kubeconfig, else every file in KUBECONFIG, merged,
+	// split on the OS's list separator (";" on Windows), else ~/.kube/config with the
+	// home directory resolved as kubectl does, from HOME or USERPROFILE on Windows
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = f.Kubeconfig
+	slog.Debug("loading kubeconfig", "files", loadingRules.GetLoadingPrecedence())
+
+	if f.Token != "" && f.TokenFile != "" {
+		return errors.New("-token and -token-file cannot be used together")
+	}
+	if (f.ClientCertificate == "") != (f.ClientKey == "") {
+		return errors.New("-client-certificate and -client-key must be used together")
+	}
+	configOverrides := &clientcmd.ConfigOverrides{
+		CurrentContext: f.Context,
+		ClusterInfo: clientcmdapi.Cluster{
+			Server:                f.Server,
+			CertificateAuthority:  f.CertificateAuthority,
+			InsecureSkipTLSVerify: f.InsecureSkipTLSVerify,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Token:             f.Token,
+			TokenFile:         f.TokenFile,
+			ClientCertificate: f.ClientCertificate,
+			ClientKey:         f.ClientKey,
+		},
+	}
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+
+	// Build the rest config using the selected context
+	config, err := kubeConfig.ClientConfig()
+	if clientcmd.IsEmptyConfig(err) {
+		return fmt.Errorf("no kubeconfig found in %s: point KUBECONFIG or -kubeconfig at one, or connect with -server and -token", kubeconfigSources(loadingRules))
+	}
+	if err != nil {
+		return fmt.Errorf("building client config: %w", err)
+	}
+
+	s.Cluster = config.Host
+
+	// Defaults well above client-go's 5/10 avoid client-side throttling
+	config.QPS = float32(f.QPS)
+	config.Burst = f.Burst
+	// One limiter shared by all clients, counting the requests it delays for -stats
+	config.RateLimiter = s.Metrics.RateLimiter(flowcontrol.NewTokenBucketRateLimiter(config.QPS, config.Burst))
+
+	// If the namespace flag is not set, get it from the selected context ("default" if it has none)
+	s.Namespace = f.Namespace
+	if s.Namespace == "" && !f.AllNamespaces {
+		s.Namespace, _, err = kubeConfig.Namespace()
+		if err != nil {
+			return fmt.Errorf("loading kubeconfig: %w", err)
+		}
+	}
+
+	// If allNamespaces is set, clear the namespace to scan all
+	if f.AllNamespaces {
+		s.Namespace = ""
+	}
+
+	slog.Debug("resolved scan target", "context", f.Context, "namespace", s.Namespace, "allNamespaces", f.AllNamespaces)
+
+	// Count requests for -debug retries
+	config.Wrap(s.Metrics.Wrap)
+
+	if s.TracerProvider != nil {
+		config.Wrap(scan.PropagateTrace)
+	}
+
+	// Collect warnings, such as deprecated versions, by CRD rather than printing each
+	config.WarningHandlerWithContext = s.Warnings
+
+	// Apiextensions client to list all the CRDs. The typed CRDs can be decoded from
+	// protobuf, several times smaller and faster to parse than the multi-MB JSON list.
+	crdConfig := rest.CopyConfig(config)
+	crdConfig.ContentType = runtime.ContentTypeProtobuf
+	crdConfig.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	s.APIExtensionsClient, err = apiextensionsclientset.NewForConfig(crdConfig)
+	if err != nil {
+		return fmt.Errorf("creating apiextensions client: %w", err)
+	}
+
+	// Dynamic client to fetch instances of the CRDs
+	s.DynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("creating dynamic client: %w", err)
+	}
+
+	// Share kubectl's discovery cache, and keep the full CRD list next to it
+	if f.CacheDir != "" {
+		dir := discoveryCacheDir(f.CacheDir, config.Host)
+		s.DiscoveryClient, err = disk.NewCachedDiscoveryClientForConfig(config, dir, filepath.Join(f.CacheDir, "http"), 6*time.Hour)
+		if err != nil {
+			return fmt.Errorf("creating cached discovery client: %w", err)
+		}
+		s.MetadataClient, err = metadata.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("creating metadata client: %w", err)
+		}
+		s.CRDCache = filepath.Join(dir, "kgcr-crds.json")
+		if f.Incremental {
+			contextName, authInfo := f.Context, ""
+			if raw, err := kubeConfig.RawConfig(); err == nil {
+				if contextName == "" {
+					contextName = raw.CurrentContext
+				}
+				if c := raw.Contexts[contextName]; c != nil {
+					authInfo = c.AuthInfo
+				}
+			}
+			s.Incremental = scan.NewIncrementalState(incrementalStateDir(dir, contextName, authInfo, config))
+		}
+	}
+
+	return nil
+}
+
+// Parse parses args with parseArgs, then sets up logging from the parsed flags.
+func (f *Flags) Parse(fs *flag.FlagSet, args []string) []string {
+	positional := parseArgs(fs, args)
+	if err := setupLogging(f.Verbosity, f.Quiet, f.LogFormat); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(2)
+	}
+	return positional
+}
+
+// parseArgs parses flags that may appear before or after positional arguments,
+// e.g. `kgcr refs secret/my-tls -n prod`, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
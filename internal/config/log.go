@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"kgcr/internal/scan"
+)
+
+// verbosityLevels maps -v 0..4 to the lowest level that is logged.
+var verbosityLevels = []slog.Level{slog.LevelWarn, slog.LevelInfo, slog.LevelDebug, scan.LevelTrace, scan.LevelAll}
+
+// setupLogging installs the default slog logger, writing to stderr so that stdout only ever
+// carries command output. Unless -v asks for more, quiet only logs errors.
+func setupLogging(verbosity int, quiet bool, format string) error {
+	if verbosity < 0 || verbosity >= len(verbosityLevels) {
+		return fmt.Errorf("invalid -v %d: must be between 0 and %d", verbosity, len(verbosityLevels)-1)
+	}
+	opts := &slog.HandlerOptions{Level: verbosityLevels[verbosity]}
+	if quiet && verbosity == 0 {
+		opts.Level = slog.LevelError
+	}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid -log-format %q: must be text or json", format)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"kgcr/internal/offline"
+	"kgcr/internal/scan"
+)
+
+// Offline reports whether the scan reads manifests on disk, with -from-dir or -from-dump,
+// instead of a cluster.
+func (f *Flags) Offline() bool {
+	return f.FromDir != "" || f.FromDump != ""
+}
+
+// loadOffline serves the scan from the manifests under -from-dir or in the -from-dump
+// cluster dump instead of a cluster. Without -n, every namespace in the manifests is
+// scanned.
+func (f *Flags) loadOffline(s *scan.Scanner) error {
+	if f.FromDir != "" && f.FromDump != "" {
+		return errors.New("-from-dir and -from-dump cannot be used together")
+	}
+	if s.Discovery {
+		return errors.New("-source discovery needs a cluster and cannot be used with -from-dir or -from-dump")
+	}
+	var objects []*unstructured.Unstructured
+	var err error
+	if f.FromDir != "" {
+		s.Cluster = f.FromDir
+		objects, err = offline.ReadDir(f.FromDir)
+	} else {
+		s.Cluster = f.FromDump
+		objects, err = offline.ReadDump(f.FromDump)
+	}
+	if err != nil {
+		return err
+	}
+	s.APIExtensionsClient, s.DynamicClient, err = offline.Clients(objects)
+	if err != nil {
+		return err
+	}
+
+	s.Namespace = f.Namespace
+	if f.AllNamespaces {
+		s.Namespace = ""
+	}
+	s.AllNamespaces = s.Namespace == ""
+	slog.Debug("resolved scan target", "dir", f.FromDir, "dump", f.FromDump, "namespace", s.Namespace, "allNamespaces", s.AllNamespaces)
+	return nil
+}
@@ -0,0 +1,17 @@
+package config
+
+import (
+	"log/slog"
+	"net/http"
+	_ "net/http/pprof"
+)
+
+// servePprof serves the net/http/pprof endpoints on addr, e.g. :6060, for the life of the process.
+func servePprof(addr string) {
+	go func() {
+		slog.Info("serving pprof", "addr", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			slog.Error("pprof server failed", "addr", addr, "error", err)
+		}
+	}()
+}
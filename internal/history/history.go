@@ -0,0 +1,237 @@
+// Package history keeps the per-CRD instance counts of past scans in a local SQLite
+// database, so that `kgcr history` can show how each CRD grows over time.
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/util/homedir"
+
+	_ "modernc.org/sqlite" // registers the pure-Go sqlite driver, as releases build without cgo
+)
+
+// schema holds one row per recorded scan and one per CRD and scan. namespace is empty for
+// scans of all namespaces; trends only compare scans of the same cluster and namespace.
+const schema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id         INTEGER PRIMARY KEY,
+	scanned_at TEXT NOT NULL,
+	cluster    TEXT NOT NULL,
+	namespace  TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS counts (
+	scan_id   INTEGER NOT NULL REFERENCES scans (id),
+	crd       TEXT NOT NULL,
+	instances INTEGER NOT NULL,
+	bytes     INTEGER NOT NULL,
+	PRIMARY KEY (scan_id, crd)
+);
+CREATE INDEX IF NOT EXISTS scans_target ON scans (cluster, namespace, scanned_at);
+`
+
+// DefaultPath returns history.db in kgcr's data directory, $XDG_DATA_HOME/kgcr or
+// ~/.local/share/kgcr, or %LOCALAPPDATA%\kgcr on Windows.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" && runtime.GOOS == "windows" {
+		dir = os.Getenv("LOCALAPPDATA")
+	}
+	if dir == "" {
+		home := homedir.HomeDir()
+		if home == "" {
+			return "", errors.New("finding the history directory: no home directory")
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "kgcr", "history.db"), nil
+}
+
+// Store is an open history database.
+type Store struct {
+	db   *sql.DB
+	path string
+}
+
+// Open opens the history database at path, creating it, its directory and its tables if
+// needed.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating tables in %s: %w", path, err)
+	}
+	return &Store{db: db, path: path}, nil
+}
+
+// Close closes the database.
+func (st *Store) Close() error {
+	return st.db.Close()
+}
+
+// Count is what a scan found of one CRD.
+type Count struct {
+	Instances int   `json:"instances"`
+	Bytes     int64 `json:"bytes"` // total serialized size of the instances
+}
+
+// Record adds a scan of cluster and namespace at the given time with its counts per CRD.
+// CRDs without instances should be recorded with a zero Count, so that a CRD emptying
+// out shows as a drop rather than as gone.
+func (st *Store) Record(at time.Time, cluster, namespace string, counts map[string]Count) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	scan, err := tx.Exec(`INSERT INTO scans (scanned_at, cluster, namespace) VALUES (?, ?, ?)`,
+		at.UTC().Format(time.RFC3339), cluster, namespace)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", st.path, err)
+	}
+	scanID, err := scan.LastInsertId()
+	if err != nil {
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO counts (scan_id, crd, instances, bytes) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for crd, c := range counts {
+		if _, err := insert.Exec(scanID, crd, c.Instances, c.Bytes); err != nil {
+			return fmt.Errorf("writing %s: %w", st.path, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ErrNoScans is returned by Trends when no scan of the cluster and namespace was recorded.
+var ErrNoScans = errors.New("no scans recorded")
+
+// Trend compares a CRD in the first and last recorded scans of a period. A CRD missing
+// from a scan, as it did not exist yet or any more, counts as zero there.
+type Trend struct {
+	CRD  string `json:"crd"`
+	From Count  `json:"from"`
+	To   Count  `json:"to"`
+}
+
+// Growth returns the change in instances as a fraction of the first count, e.g. 0.4 for
+// 40% more; ok is false when the CRD had no instances to start with.
+func (t *Trend) Growth() (growth float64, ok bool) {
+	if t.From.Instances == 0 {
+		return 0, false
+	}
+	return float64(t.To.Instances-t.From.Instances) / float64(t.From.Instances), true
+}
+
+// Period is the first and last scans Trends compared, and how many were recorded.
+type Period struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Scans int       `json:"scans"`
+}
+
+// Trends compares every CRD between the first scan of cluster and namespace since the
+// given time and the latest one. The trends are sorted by the change in instances, the
+// largest growth first.
+func (st *Store) Trends(cluster, namespace string, since time.Time) ([]Trend, Period, error) {
+	rows, err := st.db.Query(`SELECT id, scanned_at FROM scans WHERE cluster = ? AND namespace = ? AND scanned_at >= ? ORDER BY scanned_at, id`,
+		cluster, namespace, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, Period{}, fmt.Errorf("reading %s: %w", st.path, err)
+	}
+	var ids []int64
+	var period Period
+	for rows.Next() {
+		var id int64
+		var at string
+		if err := rows.Scan(&id, &at); err != nil {
+			rows.Close()
+			return nil, Period{}, err
+		}
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			rows.Close()
+			return nil, Period{}, fmt.Errorf("reading %s: invalid scan time %q", st.path, at)
+		}
+		if len(ids) == 0 {
+			period.From = t
+		}
+		period.To = t
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, Period{}, err
+	}
+	if len(ids) == 0 {
+		return nil, Period{}, ErrNoScans
+	}
+	period.Scans = len(ids)
+
+	byCRD := map[string]*Trend{}
+	for i, id := range []int64{ids[0], ids[len(ids)-1]} {
+		counts, err := st.counts(id)
+		if err != nil {
+			return nil, Period{}, err
+		}
+		for crd, c := range counts {
+			t := byCRD[crd]
+			if t == nil {
+				t = &Trend{CRD: crd}
+				byCRD[crd] = t
+			}
+			if i == 0 {
+				t.From = c
+			} else {
+				t.To = c
+			}
+		}
+	}
+
+	trends := make([]Trend, 0, len(byCRD))
+	for _, t := range byCRD {
+		trends = append(trends, *t)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		a, b := trends[i].To.Instances-trends[i].From.Instances, trends[j].To.Instances-trends[j].From.Instances
+		if a != b {
+			return a > b
+		}
+		return trends[i].CRD < trends[j].CRD
+	})
+	return trends, period, nil
+}
+
+// counts returns the counts recorded in a scan.
+func (st *Store) counts(scanID int64) (map[string]Count, error) {
+	rows, err := st.db.Query(`SELECT crd, instances, bytes FROM counts WHERE scan_id = ?`, scanID)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", st.path, err)
+	}
+	defer rows.Close()
+	counts := map[string]Count{}
+	for rows.Next() {
+		var crd string
+		var c Count
+		if err := rows.Scan(&crd, &c.Instances, &c.Bytes); err != nil {
+			return nil, err
+		}
+		counts[crd] = c
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTrends(t *testing.T) {
+	st, err := Open(filepath.Join(t.TempDir(), "kgcr", "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	now := time.Now()
+	scans := []struct {
+		at     time.Time
+		counts map[string]Count
+	}{
+		// Outside the compared period
+		{now.Add(-60 * 24 * time.Hour), map[string]Count{"kafkatopics.kafka.strimzi.io": {Instances: 1}}},
+		{now.Add(-20 * 24 * time.Hour), map[string]Count{
+			"kafkatopics.kafka.strimzi.io": {Instances: 100, Bytes: 1000},
+			"backups.velero.io":            {Instances: 10, Bytes: 500},
+		}},
+		{now.Add(-10 * 24 * time.Hour), map[string]Count{"kafkatopics.kafka.strimzi.io": {Instances: 120}}},
+		{now, map[string]Count{
+			"kafkatopics.kafka.strimzi.io": {Instances: 140, Bytes: 1400},
+			"backups.velero.io":            {Instances: 5, Bytes: 250},
+			"certificates.cert-manager.io": {Instances: 3, Bytes: 30},
+		}},
+	}
+	for _, sc := range scans {
+		if err := st.Record(sc.at, "https://prod:6443", "", sc.counts); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	// Another cluster does not count
+	if err := st.Record(now, "https://dev:6443", "", map[string]Count{"backups.velero.io": {Instances: 1000}}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	trends, period, err := st.Trends("https://prod:6443", "", now.Add(-30*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Trends() error = %v", err)
+	}
+	if period.Scans != 3 {
+		t.Errorf("Trends() compared %d scans, want 3", period.Scans)
+	}
+	want := []Trend{
+		{CRD: "kafkatopics.kafka.strimzi.io", From: Count{100, 1000}, To: Count{140, 1400}},
+		{CRD: "certificates.cert-manager.io", To: Count{3, 30}},
+		{CRD: "backups.velero.io", From: Count{10, 500}, To: Count{5, 250}},
+	}
+	if len(trends) != len(want) {
+		t.Fatalf("Trends() = %+v, want %+v", trends, want)
+	}
+	for i := range want {
+		if trends[i] != want[i] {
+			t.Errorf("trend %d = %+v, want %+v", i, trends[i], want[i])
+		}
+	}
+	if growth, ok := trends[0].Growth(); !ok || growth < 0.399 || growth > 0.401 {
+		t.Errorf("Growth() = %v, %v, want 0.4", growth, ok)
+	}
+	if _, ok := trends[1].Growth(); ok {
+		t.Error("Growth() of a new CRD is ok, want no growth from zero")
+	}
+
+	if _, _, err := st.Trends("https://prod:6443", "default", now.Add(-time.Hour)); !errors.Is(err, ErrNoScans) {
+		t.Errorf("Trends() of an unrecorded namespace error = %v, want ErrNoScans", err)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", filepath.Join("data", "home"))
+	if got, err := DefaultPath(); err != nil || got != filepath.Join("data", "home", "kgcr", "history.db") {
+		t.Errorf("DefaultPath() = %q, %v", got, err)
+	}
+
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HOME", filepath.Join("users", "me"))
+	t.Setenv("LOCALAPPDATA", filepath.Join("users", "me", "AppData", "Local"))
+	want := filepath.Join("users", "me", ".local", "share", "kgcr", "history.db")
+	if runtime.GOOS == "windows" {
+		want = filepath.Join("users", "me", "AppData", "Local", "kgcr", "history.db")
+	}
+	if got, err := DefaultPath(); err != nil || got != want {
+		t.Errorf("DefaultPath() = %q, %v, want %q", got, err, want)
+	}
+}
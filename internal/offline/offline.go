@@ -0,0 +1,353 @@
+// Package offline loads custom resources from files on disk into fake API clients, so that
+// a scan can run against a backup, export or cluster dump without cluster access.
+package offline
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// ReadDir reads every .json, .yaml and .yml file under dir. Files may hold one object,
+// several YAML documents or a List, such as the output of `kgcr -o json` or `kubectl get
+// -o yaml`. Velero backups, extracted, store one JSON file per object under
+// resources/<resource>.<group>/, which is read the same way. Files that are not
+// Kubernetes objects are skipped.
+func ReadDir(dir string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isManifest(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, decodeFile(path, data)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dir, err)
+	}
+	slog.Info("read manifests", "dir", dir, "objects", len(objects))
+	return objects, nil
+}
+
+// isManifest reports whether path has a manifest file extension.
+func isManifest(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// decodeFile returns the objects in the file at path, or none if it is not a manifest.
+func decodeFile(path string, data []byte) []*unstructured.Unstructured {
+	// Support bundles save the CRD list from a typed client, whose items have no kind
+	var fallback schema.GroupVersionKind
+	if strings.HasPrefix(filepath.Base(path), "custom-resource-definitions.") {
+		fallback = crdGVK
+	}
+	objects, err := decode(data, fallback)
+	if err != nil {
+		slog.Debug("skipping file that is not a Kubernetes manifest", "file", path, "error", err)
+		return nil
+	}
+	return objects
+}
+
+// Decode returns the objects in data, which is JSON or one or more YAML documents. Lists,
+// with or without a kind, and JSON arrays are flattened into their items.
+func Decode(data []byte) ([]*unstructured.Unstructured, error) {
+	return decode(data, schema.GroupVersionKind{})
+}
+
+// decode is Decode, with fallback set on objects that have no apiVersion and kind.
+func decode(data []byte, fallback schema.GroupVersionKind) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, err
+		}
+		// Decode numbers as int64 where they are integers, like the API machinery does
+		var doc interface{}
+		if err := utiljson.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		objects = appendObjects(objects, doc, fallback)
+	}
+}
+
+// appendObjects appends the object in doc, or the items of a list or array, to objects.
+func appendObjects(objects []*unstructured.Unstructured, doc interface{}, fallback schema.GroupVersionKind) []*unstructured.Unstructured {
+	switch doc := doc.(type) {
+	case []interface{}:
+		for _, item := range doc {
+			objects = appendObjects(objects, item, fallback)
+		}
+	case map[string]interface{}:
+		obj := &unstructured.Unstructured{Object: doc}
+		if items, ok := doc["items"].([]interface{}); ok && (obj.GetKind() == "" || strings.HasSuffix(obj.GetKind(), "List")) {
+			return appendObjects(objects, items, fallback)
+		}
+		if obj.GetKind() == "" && !fallback.Empty() {
+			obj.SetGroupVersionKind(fallback)
+		}
+		if obj.GetAPIVersion() != "" && obj.GetKind() != "" {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+// ReadDump reads a cluster dump: a directory, such as one written by `kubectl
+// cluster-info dump --output-directory` or an extracted support bundle, a .tar.gz, .tgz or
+// .tar support bundle, or a single file of concatenated objects, such as the standard
+// output of `kubectl cluster-info dump`.
+func ReadDump(path string) ([]*unstructured.Unstructured, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return ReadDir(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+		fallthrough
+	case strings.HasSuffix(lower, ".tar"):
+		objects, err := readTar(r)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		slog.Info("read dump", "file", path, "objects", len(objects))
+		return objects, nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	slog.Info("read dump", "file", path, "objects", len(objects))
+	return objects, nil
+}
+
+// readTar returns the objects in the manifest files of a tar archive.
+func readTar(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !isManifest(hdr.Name) {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, decodeFile(hdr.Name, data)...)
+	}
+}
+
+var crdGVK = apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition")
+
+// wellKnownLists are the list kinds of the non-CRD resources kgcr looks up: OLM
+// ClusterServiceVersions for -operator and -group-by operator, APIServices, Namespaces
+// for kgcr matrix and ResourceQuotas for -show-quota.
+var wellKnownLists = map[schema.GroupVersionResource]string{
+	{Group: "operators.coreos.com", Version: "v1alpha1", Resource: "clusterserviceversions"}: "ClusterServiceVersionList",
+	{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}:                "APIServiceList",
+	{Version: "v1", Resource: "namespaces"}:                                                  "NamespaceList",
+	{Version: "v1", Resource: "resourcequotas"}:                                              "ResourceQuotaList",
+}
+
+var (
+	namespacesGVR     = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	resourceQuotasGVR = schema.GroupVersionResource{Version: "v1", Resource: "resourcequotas"}
+)
+
+// Clients returns fake apiextensions and dynamic clients serving objects. CRDs among the
+// objects are served as they are; custom resources without one, as in an export of
+// instances only, get a CRD guessed from their kind and namespace. Instances are served
+// at their CRD's storage version, without conversion.
+func Clients(objects []*unstructured.Unstructured) (apiextensionsclientset.Interface, dynamic.Interface, error) {
+	crds := map[schema.GroupKind]*apiextensionsv1.CustomResourceDefinition{}
+	for _, obj := range objects {
+		if obj.GroupVersionKind() != crdGVK {
+			continue
+		}
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, crd); err != nil {
+			return nil, nil, fmt.Errorf("decoding CRD %s: %w", obj.GetName(), err)
+		}
+		crds[schema.GroupKind{Group: crd.Spec.Group, Kind: crd.Spec.Names.Kind}] = crd
+	}
+
+	// Built-in kinds, such as the Deployments in a Velero backup, are not custom resources;
+	// of those, only Namespaces and ResourceQuotas are served
+	var instances, namespaces, quotas []*unstructured.Unstructured
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		if gvk.Group == "" && gvk.Kind == "Namespace" {
+			namespaces = append(namespaces, obj)
+			continue
+		}
+		if gvk.Group == "" && gvk.Kind == "ResourceQuota" {
+			quotas = append(quotas, obj)
+			continue
+		}
+		if gvk == crdGVK || scheme.Scheme.IsGroupRegistered(gvk.Group) {
+			continue
+		}
+		if _, ok := crds[gvk.GroupKind()]; !ok {
+			crds[gvk.GroupKind()] = guessCRD(obj)
+		}
+		instances = append(instances, obj)
+	}
+
+	var crdObjects []runtime.Object
+	listKinds := map[schema.GroupVersionResource]string{}
+	// Resources kgcr lists besides custom resources, which the fake client must know about
+	// even when the directory has none
+	for gvr, kind := range wellKnownLists {
+		listKinds[gvr] = kind
+	}
+	for _, crd := range crds {
+		// Manifests rarely carry status; a CRD only counts as not Established if it says so
+		if len(crd.Status.Conditions) == 0 {
+			crd.Status.Conditions = []apiextensionsv1.CustomResourceDefinitionCondition{{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue}}
+		}
+		crdObjects = append(crdObjects, crd)
+		for _, v := range crd.Spec.Versions {
+			listKinds[schema.GroupVersionResource{Group: crd.Spec.Group, Version: v.Name, Resource: crd.Spec.Names.Plural}] = crd.Spec.Names.Kind + "List"
+		}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+	for _, obj := range instances {
+		crd := crds[obj.GroupVersionKind().GroupKind()]
+		gvr := schema.GroupVersionResource{Group: crd.Spec.Group, Version: storageVersion(crd), Resource: crd.Spec.Names.Plural}
+		if err := dynamicClient.Tracker().Create(gvr, obj, obj.GetNamespace()); err != nil {
+			slog.Debug("skipping duplicate object", "gvr", gvr.String(), "namespace", obj.GetNamespace(), "name", obj.GetName(), "error", err)
+		}
+	}
+	for _, obj := range namespaces {
+		if err := dynamicClient.Tracker().Create(namespacesGVR, obj, ""); err != nil {
+			slog.Debug("skipping duplicate namespace", "name", obj.GetName(), "error", err)
+		}
+	}
+	for _, obj := range quotas {
+		if err := dynamicClient.Tracker().Create(resourceQuotasGVR, obj, obj.GetNamespace()); err != nil {
+			slog.Debug("skipping duplicate resource quota", "namespace", obj.GetNamespace(), "name", obj.GetName(), "error", err)
+		}
+	}
+	// Exports of instances often leave out their Namespaces, which -namespace-regex and
+	// kgcr matrix list, so those get a bare one
+	for _, obj := range instances {
+		if obj.GetNamespace() == "" {
+			continue
+		}
+		if _, err := dynamicClient.Tracker().Get(namespacesGVR, "", obj.GetNamespace()); err == nil {
+			continue
+		}
+		ns := &unstructured.Unstructured{}
+		ns.SetAPIVersion("v1")
+		ns.SetKind("Namespace")
+		ns.SetName(obj.GetNamespace())
+		if err := dynamicClient.Tracker().Create(namespacesGVR, ns, ""); err != nil {
+			return nil, nil, fmt.Errorf("adding namespace %s: %w", ns.GetName(), err)
+		}
+	}
+	return apiextensionsfake.NewClientset(crdObjects...), dynamicClient, nil
+}
+
+// guessCRD returns a CRD for obj's kind, with the plural kubectl would guess and the
+// scope implied by whether obj has a namespace.
+func guessCRD(obj *unstructured.Unstructured) *apiextensionsv1.CustomResourceDefinition {
+	gvk := obj.GroupVersionKind()
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	scope := apiextensionsv1.NamespaceScoped
+	if obj.GetNamespace() == "" {
+		scope = apiextensionsv1.ClusterScoped
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: gvk.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: gvk.Kind, Plural: plural.Resource},
+			Scope: scope,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: gvk.Version, Served: true, Storage: true},
+			},
+		},
+	}
+	crd.Name = plural.Resource + "." + gvk.Group
+	return crd
+}
+
+// storageVersion returns crd's storage version, or its first version if none is marked.
+func storageVersion(crd *apiextensionsv1.CustomResourceDefinition) string {
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	if len(crd.Spec.Versions) > 0 {
+		return crd.Spec.Versions[0].Name
+	}
+	return ""
+}
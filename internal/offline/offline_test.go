@@ -0,0 +1,198 @@
+package offline
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listNames lists gvr through the fake dynamic client built from dir.
+func listNames(t *testing.T, dir string, gvr schema.GroupVersionResource) []string {
+	t.Helper()
+	objects, err := ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	return clientNames(t, objects, gvr)
+}
+
+// clientNames lists gvr through the fake dynamic client built from objects.
+func clientNames(t *testing.T, objects []*unstructured.Unstructured, gvr schema.GroupVersionResource) []string {
+	t.Helper()
+	_, dynamicClient, err := Clients(objects)
+	if err != nil {
+		t.Fatalf("Clients() error = %v", err)
+	}
+	list, err := dynamicClient.Resource(gvr).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List(%s) error = %v", gvr, err)
+	}
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.GetNamespace()+"/"+item.GetName())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestReadDirExport(t *testing.T) {
+	dir := t.TempDir()
+	// A kgcr -o json export: instances only, with server-populated fields
+	writeFile(t, filepath.Join(dir, "export.json"), `{
+    "apiVersion": "v1",
+    "kind": "List",
+    "items": [
+        {"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "a", "namespace": "default", "resourceVersion": "42"}},
+        {"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "b", "namespace": "prod"}}
+    ]
+}`)
+	writeFile(t, filepath.Join(dir, "more.yaml"), `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: c
+  namespace: prod
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: not-a-custom-resource
+  namespace: prod
+`)
+	writeFile(t, filepath.Join(dir, "README.md"), "not a manifest")
+	writeFile(t, filepath.Join(dir, "broken.json"), "{")
+
+	got := listNames(t, dir, schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"})
+	if want := []string{"default/a", "prod/b", "prod/c"}; !slices.Equal(got, want) {
+		t.Errorf("widgets = %v, want %v", got, want)
+	}
+}
+
+func TestReadDirVelero(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "resources/customresourcedefinitions.apiextensions.k8s.io/cluster/octopi.example.com.json"), `{
+    "apiVersion": "apiextensions.k8s.io/v1",
+    "kind": "CustomResourceDefinition",
+    "metadata": {"name": "octopi.example.com"},
+    "spec": {
+        "group": "example.com",
+        "names": {"kind": "Octopus", "plural": "octopi"},
+        "scope": "Namespaced",
+        "versions": [{"name": "v1beta1", "served": true, "storage": false}, {"name": "v1", "served": true, "storage": true}]
+    }
+}`)
+	// The plural comes from the CRD, not a guess from the kind, and the instance saved
+	// at v1beta1 is served at the storage version
+	writeFile(t, filepath.Join(dir, "resources/octopi.example.com/namespaces/sea/inky.json"),
+		`{"apiVersion": "example.com/v1beta1", "kind": "Octopus", "metadata": {"name": "inky", "namespace": "sea"}}`)
+	writeFile(t, filepath.Join(dir, "resources/pods/namespaces/sea/pod.json"),
+		`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "pod", "namespace": "sea"}}`)
+
+	got := listNames(t, dir, schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "octopi"})
+	if want := []string{"sea/inky"}; !slices.Equal(got, want) {
+		t.Errorf("octopi = %v, want %v", got, want)
+	}
+}
+
+func TestReadDumpSupportBundle(t *testing.T) {
+	// A troubleshoot support bundle: the CRD list is saved from a typed client, so it and
+	// its items have no kind, and custom resources are bare JSON arrays per namespace
+	files := map[string]string{
+		"bundle/cluster-resources/custom-resource-definitions.json": `{
+    "metadata": {"resourceVersion": "1"},
+    "items": [{
+        "metadata": {"name": "octopi.example.com"},
+        "spec": {
+            "group": "example.com",
+            "names": {"kind": "Octopus", "plural": "octopi"},
+            "scope": "Namespaced",
+            "versions": [{"name": "v1", "served": true, "storage": true}]
+        }
+    }]
+}`,
+		"bundle/cluster-resources/custom-resources/octopi.example.com/sea.json": `[
+    {"apiVersion": "example.com/v1", "kind": "Octopus", "metadata": {"name": "inky", "namespace": "sea"}, "spec": {"arms": 8}},
+    {"apiVersion": "example.com/v1", "kind": "Octopus", "metadata": {"name": "blinky", "namespace": "sea"}}
+]`,
+		"bundle/cluster-resources/pods/sea.json": `[{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "pod", "namespace": "sea"}}]`,
+		"bundle/version.yaml":                    "apiVersion: troubleshoot.sh/v1beta2\nkind: SupportBundleVersion\n",
+	}
+	path := filepath.Join(t.TempDir(), "support-bundle.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []interface{ Close() error }{tw, gz, f} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, err := ReadDump(path)
+	if err != nil {
+		t.Fatalf("ReadDump() error = %v", err)
+	}
+	got := clientNames(t, objects, schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "octopi"})
+	if want := []string{"sea/blinky", "sea/inky"}; !slices.Equal(got, want) {
+		t.Errorf("octopi = %v, want %v", got, want)
+	}
+	for _, obj := range objects {
+		if obj.GetName() == "inky" {
+			// Integers stay integers, as CEL and jq expect
+			if arms, _, _ := unstructured.NestedInt64(obj.Object, "spec", "arms"); arms != 8 {
+				t.Errorf("inky spec.arms = %v, want int64 8", obj.Object["spec"])
+			}
+		}
+	}
+}
+
+func TestReadDumpStream(t *testing.T) {
+	// `kubectl cluster-info dump` to stdout: concatenated List objects
+	path := filepath.Join(t.TempDir(), "dump.json")
+	writeFile(t, path, `{
+    "kind": "NodeList",
+    "apiVersion": "v1",
+    "items": [{"apiVersion": "v1", "kind": "Node", "metadata": {"name": "node-1"}}]
+}
+{
+    "kind": "WidgetList",
+    "apiVersion": "example.com/v1",
+    "items": [{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "a", "namespace": "default"}}]
+}
+`)
+	objects, err := ReadDump(path)
+	if err != nil {
+		t.Fatalf("ReadDump() error = %v", err)
+	}
+	got := clientNames(t, objects, schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"})
+	if want := []string{"default/a"}; !slices.Equal(got, want) {
+		t.Errorf("widgets = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package output
+
+import (
+	"fmt"
+	"os"
+)
+
+// SGR color codes used in table output. All are two digits so that every colored cell
+// carries the same number of escape bytes and tabwriter keeps the columns aligned.
+const (
+	colorDefault = "39"
+	colorBold    = "01"
+	colorRed     = "31"
+	colorGreen   = "32"
+	colorYellow  = "33"
+	colorMagenta = "35"
+	colorCyan    = "36"
+)
+
+// paint wraps s in the given SGR color code.
+func paint(code, s string) string {
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// UseColor resolves a -color mode of auto, always or never. In auto mode output is colored
+// only when out is a terminal and the NO_COLOR environment variable is unset or empty.
+func UseColor(mode string, out *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		return IsTerminal(out), nil
+	}
+	return false, fmt.Errorf("invalid -color %q: must be auto, always or never", mode)
+}
+
+// IsTerminal reports whether f is an interactive terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
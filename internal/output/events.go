@@ -0,0 +1,104 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"kgcr/internal/scan"
+)
+
+// eventColors color the EVENT column of -watch.
+var eventColors = map[scan.EventType]string{scan.Added: colorGreen, scan.Modified: colorYellow, scan.Deleted: colorRed}
+
+// eventGutter is the space between the columns of -watch rows.
+const eventGutter = 3
+
+// EventPrinter writes watch events as table rows led by the event's time and type, like
+// kubectl get -w --output-watch-events. Rows printed one at a time as events arrive cannot
+// be aligned by a tabwriter, so the first call sizes the columns to its header and rows
+// and later calls pad to the same widths. A wider cell widens its column from then on.
+type EventPrinter struct {
+	columns []Column
+	o       *Options
+	widths  []int
+}
+
+// NewEventPrinter returns an EventPrinter of columns, whose first call prints the header
+// row unless o.NoHeaders.
+func NewEventPrinter(columns []Column, o *Options) *EventPrinter {
+	return &EventPrinter{columns: columns, o: o}
+}
+
+// Print writes a row for each of events.
+func (p *EventPrinter) Print(out io.Writer, events []scan.Event) {
+	var rows [][]string
+	if p.widths == nil && !p.o.NoHeaders {
+		header := append([]string{"TIME", "EVENT"}, make([]string, len(p.columns))...)
+		for i, c := range p.columns {
+			header[i+2] = c.name
+		}
+		if p.o.Colored {
+			for i := range header {
+				header[i] = paint(colorBold, header[i])
+			}
+		}
+		rows = append(rows, header)
+	}
+	for i := range events {
+		ev := &events[i]
+		typ := string(ev.Type)
+		if p.o.Colored {
+			typ = paint(eventColors[ev.Type], typ)
+		}
+		cells := make([]string, len(p.columns))
+		rowCells(cells, &ev.Result, p.columns, p.o)
+		rows = append(rows, append([]string{ev.Time.UTC().Format(time.RFC3339), typ}, cells...))
+	}
+
+	if p.widths == nil {
+		p.widths = make([]int, len(p.columns)+2)
+	}
+	// Colored cells all carry the same escape bytes, so they pad alike
+	for _, row := range rows {
+		for j, cell := range row {
+			p.widths[j] = max(p.widths[j], utf8.RuneCountInString(cell))
+		}
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		b.Reset()
+		for j, cell := range row {
+			b.WriteString(cell)
+			if j < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", p.widths[j]-utf8.RuneCountInString(cell)+eventGutter))
+			}
+		}
+		fmt.Fprintln(out, b.String())
+	}
+}
+
+// jsonEvent is a line of the -watch -o json event stream.
+type jsonEvent struct {
+	Type   scan.EventType         `json:"type"`
+	Time   time.Time              `json:"time"`
+	Object map[string]interface{} `json:"object"`
+}
+
+// WriteEventJSON writes ev as one line of JSON, {"type":"ADDED","time":...,"object":{...}},
+// so the stream can be tailed as a change feed. The result must keep its object.
+func WriteEventJSON(out io.Writer, ev *scan.Event, clean bool) error {
+	obj, err := ExportObject(&ev.Result, clean)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(jsonEvent{Type: ev.Type, Time: ev.Time.UTC(), Object: obj})
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,25 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"kgcr/internal/scan"
+)
+
+// PrintGroups writes one titled table per group, with the number of instances and CRDs in each.
+func PrintGroups(out io.Writer, groups []scan.Group, label string, columns []Column, o *Options) {
+	for i, g := range groups {
+		crds := map[string]bool{}
+		for _, res := range g.Results {
+			crds[res.CRDName] = true
+		}
+		if !o.NoHeaders {
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "%s: %s (%d custom resources, %d CRDs)\n", label, g.Name, len(g.Results), len(crds))
+		}
+		PrintTable(out, g.Results, columns, o)
+	}
+}
@@ -0,0 +1,63 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"kgcr/internal/scan"
+)
+
+// PrintLabelAudit lists the instances missing any of the -require-labels keys followed by a
+// per-namespace summary of how many instances are non-compliant, and returns how many
+// instances it listed. When all are compliant, it prints nothing.
+func PrintLabelAudit(out io.Writer, results []scan.Result, o *Options) int {
+	type namespaceCount struct{ total, missing int }
+	counts := map[string]*namespaceCount{}
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, '\t', 0)
+	nonCompliant := 0
+	for _, res := range results {
+		c := counts[res.Namespace]
+		if c == nil {
+			c = &namespaceCount{}
+			counts[res.Namespace] = c
+		}
+		c.total++
+		if len(res.MissingLabels) == 0 {
+			continue
+		}
+		c.missing++
+		if nonCompliant == 0 && !o.NoHeaders {
+			fmt.Fprintln(w, "NAMESPACE\tCRD\tNAME\tMISSING LABELS")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", res.Namespace, res.CRDName, res.InstanceName, strings.Join(res.MissingLabels, ","))
+		nonCompliant++
+	}
+	w.Flush()
+
+	if nonCompliant == 0 {
+		return 0
+	}
+
+	namespaces := make([]string, 0, len(counts))
+	for ns := range counts {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	w.Init(out, 0, 8, 1, '\t', 0)
+	if !o.NoHeaders {
+		fmt.Fprintln(out)
+		fmt.Fprintln(w, "NAMESPACE\tMISSING\tTOTAL\tCOMPLIANT")
+	}
+	for _, ns := range namespaces {
+		c := counts[ns]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d%%\n", ns, c.missing, c.total, (c.total-c.missing)*100/c.total)
+	}
+	w.Flush()
+	return nonCompliant
+}
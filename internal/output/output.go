@@ -0,0 +1,427 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+
+	"kgcr/internal/scan"
+)
+
+// Options are the scan settings that decide which columns are shown by default and how
+// their values are rendered.
+type Options struct {
+	AllNamespaces bool
+	JQ            bool // a JQ column was requested with -jq-mode column
+	Size          bool
+	Source        bool // resources were discovered from more than CRDs
+	Operator      string
+	Short         bool
+
+	// SizeWarning is the size in bytes at which SIZE cells are marked WARNING; 0 disables it
+	SizeWarning        int
+	RelativeTimestamps bool
+	Colored            bool
+	NoHeaders          bool // -q prints only the result rows
+
+	// Overflow is the number of instances each CRD has beyond those listed, from
+	// -limit-per-crd; PrintTable adds a "... and N more" row after the CRD's last row
+	Overflow map[string]int
+
+	// SortByCount orders summary rows and tree nodes by their instance count, largest
+	// first, instead of by name; Reverse flips either order
+	SortByCount bool
+	Reverse     bool
+}
+
+// Column is one column the default table can show.
+type Column struct {
+	name  string
+	value func(o *Options, res *scan.Result) string
+
+	// color returns the SGR color code for a cell when output is colored; nil leaves the
+	// column in the default color
+	color func(res *scan.Result) string
+}
+
+// tableColumns is the full set of columns that -columns can choose from.
+var tableColumns = []Column{
+	{name: "NAMESPACE", value: func(o *Options, res *scan.Result) string { return res.Namespace }, color: fixedColor(colorCyan)},
+	{name: "CRD", value: func(o *Options, res *scan.Result) string { return res.CRDName }},
+	{name: "KIND", value: func(o *Options, res *scan.Result) string { return res.Kind }},
+	{name: "RESOURCE", value: func(o *Options, res *scan.Result) string { return res.ResourceName }},
+	{name: "GROUP", value: func(o *Options, res *scan.Result) string { return res.GVR.Group }, color: fixedColor(colorMagenta)},
+	{name: "VERSION", value: func(o *Options, res *scan.Result) string { return res.GVR.Version }},
+	{name: "NAME", value: func(o *Options, res *scan.Result) string { return res.InstanceName }, color: nameColor},
+	{name: "UID", value: func(o *Options, res *scan.Result) string { return res.UID }},
+	{name: "AGE", value: func(o *Options, res *scan.Result) string { return age(res.Created) }},
+	{name: "CREATED", value: func(o *Options, res *scan.Result) string { return o.formatCreated(res.Created) }},
+	{name: "OPERATOR", value: func(o *Options, res *scan.Result) string { return o.Operator }},
+	{name: "SOURCE", value: func(o *Options, res *scan.Result) string { return res.Source }},
+	{name: "JQ", value: func(o *Options, res *scan.Result) string { return res.JQValue }},
+	{name: "SIZE", value: func(o *Options, res *scan.Result) string { return FormatSize(res.Size, o.SizeWarning) }},
+}
+
+func fixedColor(code string) func(res *scan.Result) string {
+	return func(res *scan.Result) string { return code }
+}
+
+// nameColor highlights instances stuck in deletion in red and unhealthy ones in yellow.
+func nameColor(res *scan.Result) string {
+	switch {
+	case res.StuckDeleting:
+		return colorRed
+	case res.Unhealthy:
+		return colorYellow
+	}
+	return colorDefault
+}
+
+// age renders the time since created like kubectl's AGE column, e.g. 5m or 3d4h.
+func age(created time.Time) string {
+	if created.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(created))
+}
+
+// formatCreated renders a creation timestamp as RFC3339, or relative to now with -timestamps relative.
+func (o *Options) formatCreated(created time.Time) string {
+	if created.IsZero() {
+		return "<unknown>"
+	}
+	if o.RelativeTimestamps {
+		return duration.HumanDuration(time.Since(created)) + " ago"
+	}
+	return created.UTC().Format(time.RFC3339)
+}
+
+// ColumnNames lists every column name, for help and error messages.
+func ColumnNames() string {
+	names := make([]string, len(tableColumns))
+	for i, c := range tableColumns {
+		names[i] = c.name
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseColumns resolves a comma-separated, case-insensitive list of column names.
+func ParseColumns(spec string) ([]Column, error) {
+	var columns []Column
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		found := false
+		for _, c := range tableColumns {
+			if c.name == name {
+				columns = append(columns, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q: must be one of %s", name, ColumnNames())
+		}
+	}
+	return columns, nil
+}
+
+// DefaultColumns returns the columns shown when -columns is not set, which depend on
+// whether all namespaces are scanned and which optional values were requested. With Short,
+// the long CRD name is replaced by separate RESOURCE and GROUP columns.
+func DefaultColumns(o *Options) []Column {
+	spec := "CRD,RESOURCE,NAME,AGE"
+	if o.Short {
+		spec = "RESOURCE,GROUP,NAME,AGE"
+	}
+	if o.AllNamespaces {
+		spec = "NAMESPACE," + spec
+	}
+	if o.JQ {
+		spec += ",JQ"
+	}
+	if o.Size {
+		spec += ",SIZE"
+	}
+	if o.Source {
+		spec += ",SOURCE"
+	}
+	if o.Operator != "" {
+		spec += ",OPERATOR"
+	}
+	columns, _ := ParseColumns(spec)
+	return columns
+}
+
+// AnnotationColumn shows the value of one annotation. Like kubectl's -L, the header is the
+// upper-cased key without its prefix, e.g. RELEASE-NAME for meta.helm.sh/release-name.
+func AnnotationColumn(key string) Column {
+	name := key
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return Column{
+		name: strings.ToUpper(name),
+		value: func(o *Options, res *scan.Result) string {
+			if v := res.Annotations[key]; v != "" {
+				return v
+			}
+			return "<none>"
+		},
+	}
+}
+
+// Formats are the accepted -o values.
+var Formats = map[string]bool{"table": true, "wide": true, "name": true, "json": true, "ndjson": true, "yaml": true, "sqlite": true, "parquet": true, "xlsx": true, "tree": true}
+
+// WideColumns are added to the default columns by -o wide.
+func WideColumns() []Column {
+	columns, _ := ParseColumns("KIND,GROUP,VERSION")
+	return columns
+}
+
+// PrintNames writes one kind.group/name per line, like kubectl get -o name.
+func PrintNames(out io.Writer, results []scan.Result) {
+	for _, res := range results {
+		fmt.Fprintf(out, "%s.%s/%s\n", strings.ToLower(res.Kind), res.GVR.Group, res.InstanceName)
+	}
+}
+
+// cleanObject returns a copy of obj without the server-populated fields that make exported
+// manifests noisy to diff and fail to re-apply: managedFields, resourceVersion, uid,
+// creationTimestamp and status.
+func cleanObject(obj *unstructured.Unstructured) map[string]interface{} {
+	clean := obj.DeepCopy()
+	clean.SetManagedFields(nil)
+	clean.SetResourceVersion("")
+	clean.SetUID("")
+	unstructured.RemoveNestedField(clean.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(clean.Object, "status")
+	return clean.Object
+}
+
+// ExportObject returns the content of res to export, cleaned with -clean.
+func ExportObject(res *scan.Result, clean bool) (map[string]interface{}, error) {
+	obj, err := res.LoadObject()
+	if err != nil {
+		return nil, err
+	}
+	if clean {
+		return cleanObject(obj), nil
+	}
+	return obj.Object, nil
+}
+
+// PrintObjects writes the full instances as a v1 List in JSON or YAML, like kubectl get -o json.
+// results must have been scanned with KeepObjects. Non-nil stats are added under a stats key.
+// Items are loaded and written one at a time, so a spooled scan never holds every object in
+// memory; the output is the same as encoding the whole List at once.
+func PrintObjects(out io.Writer, results []scan.Result, format string, clean bool, stats *scan.Stats) error {
+	w := bufio.NewWriter(out)
+	var err error
+	if format == "yaml" {
+		err = writeYAMLList(w, results, clean, stats)
+	} else {
+		err = writeJSONList(w, results, clean, stats)
+	}
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", format, err)
+	}
+	return w.Flush()
+}
+
+// WriteNDJSON writes each full instance as compact JSON on a line of its own, with one
+// write per page so that consumers such as `jq -c` see instances while the scan still runs.
+// results must have been scanned with KeepObjects.
+func WriteNDJSON(out io.Writer, results []scan.Result, clean bool) error {
+	var buf bytes.Buffer
+	for i := range results {
+		item, err := ExportObject(&results[i], clean)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("encoding ndjson: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// writeJSONList writes the List with the keys in encoding/json's sorted order and four-space indents.
+func writeJSONList(w *bufio.Writer, results []scan.Result, clean bool, stats *scan.Stats) error {
+	w.WriteString("{\n    \"apiVersion\": \"v1\",\n    \"items\": [")
+	for i := range results {
+		item, err := ExportObject(&results[i], clean)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(item, "        ", "    ")
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n        ")
+		w.Write(data)
+	}
+	if len(results) > 0 {
+		w.WriteString("\n    ")
+	}
+	w.WriteString("],\n    \"kind\": \"List\"")
+	if stats != nil {
+		data, err := json.MarshalIndent(stats, "    ", "    ")
+		if err != nil {
+			return err
+		}
+		w.WriteString(",\n    \"stats\": ")
+		w.Write(data)
+	}
+	_, err := w.WriteString("\n}\n")
+	return err
+}
+
+// writeYAMLList writes the List as sigs.k8s.io/yaml would, with each item as a sequence entry.
+func writeYAMLList(w *bufio.Writer, results []scan.Result, clean bool, stats *scan.Stats) error {
+	w.WriteString("apiVersion: v1\n")
+	if len(results) == 0 {
+		w.WriteString("items: []\n")
+	} else {
+		w.WriteString("items:\n")
+	}
+	for i := range results {
+		item, err := ExportObject(&results[i], clean)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(item)
+		if err != nil {
+			return err
+		}
+		for j, line := range strings.SplitAfter(string(data), "\n") {
+			switch {
+			case j == 0:
+				w.WriteString("- ")
+			case line == "" || line == "\n":
+			default:
+				w.WriteString("  ")
+			}
+			w.WriteString(line)
+		}
+	}
+	w.WriteString("kind: List\n")
+	if stats != nil {
+		data, err := yaml.Marshal(map[string]interface{}{"stats": stats})
+		if err != nil {
+			return err
+		}
+		w.Write(data)
+	}
+	return nil
+}
+
+// HasColumn reports whether columns includes the named column.
+func HasColumn(columns []Column, name string) bool {
+	for _, c := range columns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintTable writes results as a tab-aligned table with the given columns. With o.Colored
+// set, every cell is wrapped in a color code, including default-colored ones, so that
+// escape sequences add the same width to every row.
+func PrintTable(out io.Writer, results []scan.Result, columns []Column, o *Options) {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, '\t', 0)
+
+	cells := make([]string, len(columns))
+	if !o.NoHeaders {
+		for i, c := range columns {
+			cells[i] = c.name
+			if o.Colored {
+				cells[i] = paint(colorBold, cells[i])
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+
+	// Overflow rows follow the last row of their CRD, whatever the sort order
+	last := map[string]int{}
+	for i := range results {
+		if o.Overflow[results[i].CRDName] != 0 {
+			last[results[i].CRDName] = i
+		}
+	}
+
+	for i := range results {
+		rowCells(cells, &results[i], columns, o)
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+
+		if j, ok := last[results[i].CRDName]; ok && j == i {
+			fmt.Fprintln(w, strings.Join(overflowRow(o, &results[i], columns), "\t"))
+		}
+	}
+	w.Flush()
+}
+
+// rowCells fills cells with res's values for columns.
+func rowCells(cells []string, res *scan.Result, columns []Column, o *Options) {
+	for j, c := range columns {
+		cells[j] = c.value(o, res)
+		if o.Colored {
+			code := colorDefault
+			if c.color != nil {
+				code = c.color(res)
+			}
+			cells[j] = paint(code, cells[j])
+		}
+	}
+}
+
+// crdColumns identify the CRD of a row and are repeated on its overflow row.
+var crdColumns = map[string]bool{"CRD": true, "KIND": true, "RESOURCE": true, "GROUP": true, "VERSION": true, "SOURCE": true, "OPERATOR": true}
+
+// overflowRow returns the cells of the "... and N more" row that follows res, the last
+// listed instance of a CRD truncated by -limit-per-crd. The message goes in the NAME
+// column, or the last column if there is none.
+func overflowRow(o *Options, res *scan.Result, columns []Column) []string {
+	more := "... and more"
+	if n := o.Overflow[res.CRDName]; n > 0 {
+		more = fmt.Sprintf("... and %d more", n)
+	}
+	at := len(columns) - 1
+	for j, c := range columns {
+		if c.name == "NAME" {
+			at = j
+		}
+	}
+
+	cells := make([]string, len(columns))
+	for j, c := range columns {
+		switch {
+		case j == at:
+			cells[j] = more
+		case crdColumns[c.name]:
+			cells[j] = c.value(o, res)
+		}
+		if o.Colored {
+			cells[j] = paint(colorDefault, cells[j])
+		}
+	}
+	return cells
+}
@@ -0,0 +1,78 @@
+package output
+
+import (
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"kgcr/internal/scan"
+)
+
+// parquetRow is one instance in -o parquet. The cluster and scan time are repeated on
+// every row, so files from many clusters and runs can be queried together as one table.
+type parquetRow struct {
+	Cluster   string            `parquet:"cluster,dict"`
+	ScannedAt time.Time         `parquet:"scanned_at,timestamp(millisecond)"`
+	CRD       string            `parquet:"crd,dict"`
+	Group     string            `parquet:"api_group,dict"`
+	Version   string            `parquet:"version,dict"`
+	Kind      string            `parquet:"kind,dict"`
+	Resource  string            `parquet:"resource,dict"`
+	Source    string            `parquet:"source,dict"`
+	Namespace string            `parquet:"namespace,dict"`
+	Name      string            `parquet:"name"`
+	UID       string            `parquet:"uid"`
+	Created   int64             `parquet:"created,optional,timestamp(millisecond)"` // Unix ms; 0 writes null
+	Size      int64             `parquet:"size"`
+	Labels    map[string]string `parquet:"labels"`
+}
+
+// parquetBatch is the number of rows buffered before they are handed to the writer.
+const parquetBatch = 1000
+
+// WriteParquet writes the results to out as a zstd-compressed Parquet file with one row
+// per instance, tagged with cluster and the time of the scan. results must have been
+// scanned with KeepObjects, for the labels.
+func WriteParquet(out io.Writer, results []scan.Result, cluster string) error {
+	w := parquet.NewGenericWriter[parquetRow](out, parquet.Compression(&parquet.Zstd))
+	scannedAt := time.Now().UTC()
+	rows := make([]parquetRow, 0, parquetBatch)
+	for i := range results {
+		res := &results[i]
+		object, err := res.LoadObject()
+		if err != nil {
+			return err
+		}
+		row := parquetRow{
+			Cluster:   cluster,
+			ScannedAt: scannedAt,
+			CRD:       res.CRDName,
+			Group:     res.GVR.Group,
+			Version:   res.GVR.Version,
+			Kind:      res.Kind,
+			Resource:  res.GVR.Resource,
+			Source:    res.Source,
+			Namespace: res.Namespace,
+			Name:      res.InstanceName,
+			UID:       res.UID,
+			Size:      int64(res.Size),
+			Labels:    object.GetLabels(),
+		}
+		if !res.Created.IsZero() {
+			row.Created = res.Created.UnixMilli()
+		}
+		rows = append(rows, row)
+
+		if len(rows) == parquetBatch {
+			if _, err := w.Write(rows); err != nil {
+				return err
+			}
+			rows = rows[:0]
+		}
+	}
+	if _, err := w.Write(rows); err != nil {
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,37 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"kgcr/internal/scan"
+)
+
+// PluginHeader is the header row of -plugin-output. Its fields and their order are part of
+// kgcr's interface for k9s plugins and other wrappers: new fields are only ever appended.
+var PluginHeader = []string{"NAMESPACE", "NAME", "RESOURCE", "KIND", "APIVERSION", "CREATED"}
+
+// PrintPlugin writes one line per instance with the fields of PluginHeader, separated by a
+// single tab and never padded or colored, for programs that split lines on tabs. RESOURCE
+// is resource.group, which kubectl accepts as is, e.g.
+// `kubectl get certificates.cert-manager.io -n prod api-cert`. CREATED is RFC3339 in UTC,
+// or empty when unknown. The header is left out with o.NoHeaders.
+func PrintPlugin(out io.Writer, results []scan.Result, o *Options) {
+	if !o.NoHeaders {
+		fmt.Fprintln(out, strings.Join(PluginHeader, "\t"))
+	}
+	for i := range results {
+		res := &results[i]
+		resource := res.GVR.Resource
+		if res.GVR.Group != "" {
+			resource += "." + res.GVR.Group
+		}
+		created := ""
+		if !res.Created.IsZero() {
+			created = res.Created.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintln(out, strings.Join([]string{res.Namespace, res.InstanceName, resource, res.Kind, res.GVR.GroupVersion().String(), created}, "\t"))
+	}
+}
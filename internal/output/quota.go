@@ -0,0 +1,99 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"kgcr/internal/scan"
+)
+
+// QuotaNearLimit is the share of an object-count quota at which a namespace is flagged
+// as close to it.
+const QuotaNearLimit = 0.8
+
+// quotaRow is a CRD in a namespace with its instances and one of its quota limits, if any.
+type quotaRow struct {
+	namespace, crd string
+	instances      int
+	limit          *scan.QuotaLimit
+}
+
+// used returns the quota's own count of the CRD's objects, or else the instances found.
+func (r *quotaRow) used() int64 {
+	if r.limit.Used >= 0 {
+		return r.limit.Used
+	}
+	return int64(r.instances)
+}
+
+// PrintQuotaUsage writes one row per CRD and namespace with its instances next to each
+// ResourceQuota object-count limit on it, and returns the namespaces that reached
+// QuotaNearLimit of a limit. The USED column is the quota controller's count where
+// reported, as it counts objects the scan filtered out.
+func PrintQuotaUsage(out io.Writer, results []scan.Result, limits []scan.QuotaLimit, o *Options) (near []string) {
+	counts := map[[2]string]int{}
+	for _, res := range results {
+		counts[[2]string{res.Namespace, res.CRDName}]++
+	}
+	var rows []quotaRow
+	limited := map[[2]string]bool{}
+	for i := range limits {
+		l := &limits[i]
+		key := [2]string{l.Namespace, l.CRD}
+		limited[key] = true
+		rows = append(rows, quotaRow{namespace: l.Namespace, crd: l.CRD, instances: counts[key], limit: l})
+	}
+	for key, n := range counts {
+		if !limited[key] {
+			rows = append(rows, quotaRow{namespace: key[0], crd: key[1], instances: n})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		if a.crd != b.crd {
+			return a.crd < b.crd
+		}
+		return a.limit != nil && b.limit != nil && a.limit.Quota < b.limit.Quota
+	})
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, '\t', 0)
+	if !o.NoHeaders {
+		fmt.Fprintln(w, "NAMESPACE\tCRD\tINSTANCES\tQUOTA\tUSED\tHARD\tHEADROOM")
+	}
+	flagged := map[string]bool{}
+	for i := range rows {
+		r := &rows[i]
+		if r.limit == nil {
+			fmt.Fprintf(w, "%s\t%s\t%d\t-\t-\t-\t-\n", r.namespace, r.crd, r.instances)
+			continue
+		}
+		used, hard := r.used(), r.limit.Hard
+		headroom := strconv.FormatInt(hard-used, 10)
+		if hard > 0 {
+			headroom += fmt.Sprintf(" (%.0f%% used)", float64(used)*100/float64(hard))
+		}
+		if float64(used) >= QuotaNearLimit*float64(hard) {
+			if !flagged[r.namespace] {
+				flagged[r.namespace] = true
+				near = append(near, r.namespace)
+			}
+			if o.Colored {
+				code := colorYellow
+				if used >= hard {
+					code = colorRed
+				}
+				headroom = paint(code, headroom)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%d\t%s\n", r.namespace, r.crd, r.instances, r.limit.Quota, used, hard, headroom)
+	}
+	w.Flush()
+	return near
+}
@@ -0,0 +1,54 @@
+package output
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"kgcr/internal/scan"
+)
+
+// RedactFormats are the -o values -redact supports: those showing only the fields it
+// redacts, and not full objects or labels.
+var RedactFormats = map[string]bool{"table": true, "wide": true, "name": true, "tree": true, "xlsx": true}
+
+// Redactor replaces names with tokens that are the same for the same name within a run,
+// so counts and relationships survive, but that cannot be reversed or guessed by hashing
+// likely names, as they are keyed with a random secret that is never written out.
+type Redactor struct {
+	key []byte
+}
+
+// NewRedactor returns a Redactor with a fresh random key.
+func NewRedactor() *Redactor {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &Redactor{key: key}
+}
+
+// Token returns prefix and a short keyed hash of s, e.g. ns-3f2a9c1b07, or "" for "".
+// The prefix separates the kinds of value, so a namespace and an instance sharing a
+// name get different tokens.
+func (r *Redactor) Token(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(prefix + "\x00" + s))
+	return prefix + "-" + hex.EncodeToString(mac.Sum(nil))[:10]
+}
+
+// Results redacts the namespaces, names and UIDs of results in place, and the systems
+// taken from their labels, keeping their CRDs, kinds, groups and everything else.
+func (r *Redactor) Results(results []scan.Result) {
+	for i := range results {
+		res := &results[i]
+		res.Namespace = r.Token("ns", res.Namespace)
+		res.InstanceName = r.Token("name", res.InstanceName)
+		res.UID = r.Token("uid", res.UID)
+		if res.System != res.GVR.Group {
+			res.System = r.Token("system", res.System)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package output
+
+import (
+	"fmt"
+)
+
+// FormatSize renders a byte count with binary units, e.g. 1.5MiB, marking sizes at or above
+// warning since updates start failing with "request entity too large" at ~1.5MiB.
+func FormatSize(bytes, warning int) string {
+	if warning > 0 && bytes >= warning {
+		return humanSize(bytes) + " WARNING"
+	}
+	return humanSize(bytes)
+}
+
+// humanSize renders a byte count with binary units.
+func humanSize(bytes int) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	value, exp := float64(bytes)/unit, 0
+	for value >= unit && exp < 2 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", value, "KMG"[exp])
+}
@@ -0,0 +1,155 @@
+package output
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the pure-Go sqlite driver, as releases build without cgo
+
+	"kgcr/internal/scan"
+)
+
+// sqliteSchema holds the inventory tables. Each kgcr run adds a row to runs and tags its
+// CRDs, instances and labels with the run's id, so periodic runs written to the same file
+// can be compared with SQL.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id         INTEGER PRIMARY KEY,
+	scanned_at TEXT NOT NULL,
+	cluster    TEXT NOT NULL,
+	namespace  TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS crds (
+	run_id    INTEGER NOT NULL REFERENCES runs (id),
+	name      TEXT NOT NULL,
+	api_group TEXT NOT NULL,
+	version   TEXT NOT NULL,
+	kind      TEXT NOT NULL,
+	resource  TEXT NOT NULL,
+	scope     TEXT NOT NULL,
+	source    TEXT NOT NULL,
+	PRIMARY KEY (run_id, name)
+);
+CREATE TABLE IF NOT EXISTS instances (
+	run_id    INTEGER NOT NULL REFERENCES runs (id),
+	crd       TEXT NOT NULL,
+	namespace TEXT NOT NULL,
+	name      TEXT NOT NULL,
+	uid       TEXT NOT NULL,
+	created   TEXT,
+	size      INTEGER NOT NULL,
+	object    TEXT NOT NULL,
+	PRIMARY KEY (run_id, crd, namespace, name),
+	FOREIGN KEY (run_id, crd) REFERENCES crds (run_id, name)
+);
+CREATE TABLE IF NOT EXISTS labels (
+	run_id    INTEGER NOT NULL,
+	crd       TEXT NOT NULL,
+	namespace TEXT NOT NULL,
+	name      TEXT NOT NULL,
+	key       TEXT NOT NULL,
+	value     TEXT NOT NULL,
+	PRIMARY KEY (run_id, crd, namespace, name, key),
+	FOREIGN KEY (run_id, crd, namespace, name) REFERENCES instances (run_id, crd, namespace, name)
+);
+CREATE INDEX IF NOT EXISTS labels_key ON labels (key, value);
+`
+
+// WriteSQLite appends the results to the SQLite database in file, creating it and its
+// tables if needed, as a new run of cluster. namespace is empty when all namespaces were
+// scanned. The instances' full objects are stored as JSON for json_extract queries; clean
+// strips the same fields as -clean does for -o json.
+func WriteSQLite(file string, results []scan.Result, cluster, namespace string, clean bool) error {
+	db, err := sql.Open("sqlite", file+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("creating tables in %s: %w", file, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := insertRun(tx, results, cluster, namespace, clean); err != nil {
+		return fmt.Errorf("writing %s: %w", file, err)
+	}
+	return tx.Commit()
+}
+
+// insertRun adds a run with the results to the tables.
+func insertRun(tx *sql.Tx, results []scan.Result, cluster, namespace string, clean bool) error {
+	run, err := tx.Exec(`INSERT INTO runs (scanned_at, cluster, namespace) VALUES (?, ?, ?)`,
+		time.Now().UTC().Format(time.RFC3339), cluster, namespace)
+	if err != nil {
+		return err
+	}
+	runID, err := run.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	insertCRD, err := tx.Prepare(`INSERT INTO crds (run_id, name, api_group, version, kind, resource, scope, source) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertCRD.Close()
+	insertInstance, err := tx.Prepare(`INSERT INTO instances (run_id, crd, namespace, name, uid, created, size, object) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertInstance.Close()
+	insertLabel, err := tx.Prepare(`INSERT INTO labels (run_id, crd, namespace, name, key, value) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertLabel.Close()
+
+	crds := map[string]bool{}
+	for i := range results {
+		res := &results[i]
+		if !crds[res.CRDName] {
+			crds[res.CRDName] = true
+			// Aggregated API resources have no CRD; only their namespaced resources are scanned
+			scope := "Namespaced"
+			if res.CRD != nil {
+				scope = string(res.CRD.Spec.Scope)
+			}
+			if _, err := insertCRD.Exec(runID, res.CRDName, res.GVR.Group, res.GVR.Version, res.Kind, res.GVR.Resource, scope, res.Source); err != nil {
+				return err
+			}
+		}
+
+		object, err := res.LoadObject()
+		if err != nil {
+			return err
+		}
+		exported := object.Object
+		if clean {
+			exported = cleanObject(object)
+		}
+		data, err := json.Marshal(exported)
+		if err != nil {
+			return err
+		}
+		var created interface{}
+		if !res.Created.IsZero() {
+			created = res.Created.UTC().Format(time.RFC3339)
+		}
+		if _, err := insertInstance.Exec(runID, res.CRDName, res.Namespace, res.InstanceName, res.UID, created, res.Size, string(data)); err != nil {
+			return err
+		}
+
+		for key, value := range object.GetLabels() {
+			if _, err := insertLabel.Exec(runID, res.CRDName, res.Namespace, res.InstanceName, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
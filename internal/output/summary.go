@@ -0,0 +1,140 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"kgcr/internal/scan"
+)
+
+// sortKeys orders the keys of a summary by name or, with SortByCount, by their counts,
+// largest first and ties by name. Reverse flips the order.
+func (o *Options) sortKeys(keys []string, counts map[string]int) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if o.Reverse {
+			a, b = b, a
+		}
+		if o.SortByCount && counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return a < b
+	})
+}
+
+// summaryHeader joins the header cells of a summary. With o.Colored set every cell is
+// painted, as every cell of the data rows is, so that escape sequences add the same width
+// to every row and tabwriter keeps the columns aligned.
+func summaryHeader(o *Options, names ...string) string {
+	if o.Colored {
+		for i := range names {
+			names[i] = paint(colorBold, names[i])
+		}
+	}
+	return strings.Join(names, "\t")
+}
+
+// summaryTopCRDs is the number of CRDs named in the TOP CRDS column of a summary row.
+const summaryTopCRDs = 3
+
+// PrintNamespaceSummary writes one row per namespace with its number of instances and
+// CRDs and the CRDs contributing the most instances, so heavy namespaces stand out.
+func PrintNamespaceSummary(out io.Writer, results []scan.Result, o *Options) {
+	counts := map[string]map[string]int{}
+	totals := map[string]int{}
+	for _, res := range results {
+		if counts[res.Namespace] == nil {
+			counts[res.Namespace] = map[string]int{}
+		}
+		counts[res.Namespace][res.CRDName]++
+		totals[res.Namespace]++
+	}
+	namespaces := make([]string, 0, len(counts))
+	for ns := range counts {
+		namespaces = append(namespaces, ns)
+	}
+	o.sortKeys(namespaces, totals)
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, '\t', 0)
+	if !o.NoHeaders {
+		fmt.Fprintln(w, summaryHeader(o, "NAMESPACE", "INSTANCES", "CRDS", "TOP CRDS"))
+	}
+	for _, ns := range namespaces {
+		cells := []string{ns, strconv.Itoa(totals[ns]), strconv.Itoa(len(counts[ns])), topCRDs(counts[ns])}
+		if o.Colored {
+			cells[0] = paint(colorCyan, cells[0])
+			for i := 1; i < len(cells); i++ {
+				cells[i] = paint(colorDefault, cells[i])
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+}
+
+// topCRDs lists the CRDs with the most instances, most first, e.g.
+// "certificates.cert-manager.io (12), issuers.cert-manager.io (3)".
+func topCRDs(counts map[string]int) string {
+	crds := make([]string, 0, len(counts))
+	for crd := range counts {
+		crds = append(crds, crd)
+	}
+	sort.Slice(crds, func(i, j int) bool {
+		if counts[crds[i]] != counts[crds[j]] {
+			return counts[crds[i]] > counts[crds[j]]
+		}
+		return crds[i] < crds[j]
+	})
+	top := make([]string, 0, summaryTopCRDs)
+	for _, crd := range crds[:min(len(crds), summaryTopCRDs)] {
+		top = append(top, fmt.Sprintf("%s (%d)", crd, counts[crd]))
+	}
+	return strings.Join(top, ", ")
+}
+
+// histogramWidth is the length, in characters, of the longest bar in a group summary.
+const histogramWidth = 40
+
+// PrintGroupSummary writes one row per API group with its number of instances and CRDs
+// and a bar scaled to the largest group, showing which operators dominate the cluster's
+// custom resources.
+func PrintGroupSummary(out io.Writer, results []scan.Result, o *Options) {
+	totals := map[string]int{}
+	crds := map[string]map[string]bool{}
+	for _, res := range results {
+		if crds[res.GVR.Group] == nil {
+			crds[res.GVR.Group] = map[string]bool{}
+		}
+		crds[res.GVR.Group][res.CRDName] = true
+		totals[res.GVR.Group]++
+	}
+	groups := make([]string, 0, len(totals))
+	largest := 0
+	for group, n := range totals {
+		groups = append(groups, group)
+		largest = max(largest, n)
+	}
+	o.sortKeys(groups, totals)
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, '\t', 0)
+	if !o.NoHeaders {
+		fmt.Fprintln(w, summaryHeader(o, "GROUP", "INSTANCES", "CRDS", "SHARE"))
+	}
+	for _, group := range groups {
+		// Every group gets at least one block, however small
+		bar := strings.Repeat("█", max(1, totals[group]*histogramWidth/largest))
+		cells := []string{group, strconv.Itoa(totals[group]), strconv.Itoa(len(crds[group])), bar}
+		if o.Colored {
+			cells[0], cells[3] = paint(colorMagenta, cells[0]), paint(colorMagenta, cells[3])
+			cells[1], cells[2] = paint(colorDefault, cells[1]), paint(colorDefault, cells[2])
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+}
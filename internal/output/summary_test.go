@@ -0,0 +1,51 @@
+package output
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"kgcr/internal/scan"
+)
+
+var (
+	sgr     = regexp.MustCompile("\x1b\\[[0-9]+m")
+	cellSep = regexp.MustCompile("\t+")
+)
+
+func TestSummaryColoredAlignment(t *testing.T) {
+	results := []scan.Result{
+		{CRDName: "widgets.example.com", Namespace: "default", GVR: schema.GroupVersionResource{Group: "example.com"}},
+		{CRDName: "widgets.example.com", Namespace: "kube-system", GVR: schema.GroupVersionResource{Group: "example.com"}},
+		{CRDName: "gadgets.acme.io", Namespace: "kube-system", GVR: schema.GroupVersionResource{Group: "acme.io"}},
+	}
+	tests := []struct {
+		name  string
+		print func(*bytes.Buffer, *Options)
+	}{
+		{"namespace", func(out *bytes.Buffer, o *Options) { PrintNamespaceSummary(out, results, o) }},
+		{"group", func(out *bytes.Buffer, o *Options) { PrintGroupSummary(out, results, o) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tt.print(&out, &Options{Colored: true})
+			// tabwriter counts escape bytes as width, so every cell of a column must carry
+			// the same number of them for the columns to line up on a terminal
+			escapes := map[int]int{}
+			for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+				for i, cell := range cellSep.Split(line, -1) {
+					n := len(cell) - len(sgr.ReplaceAllString(cell, ""))
+					if want, ok := escapes[i]; !ok {
+						escapes[i] = n
+					} else if n != want {
+						t.Errorf("cell %d of %q has %d escape bytes, want %d:\n%s", i, line, n, want, out.String())
+					}
+				}
+			}
+		})
+	}
+}
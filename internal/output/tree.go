@@ -0,0 +1,110 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"kgcr/internal/scan"
+)
+
+// treeNode is an API group, kind or namespace in -o tree, or an instance at the leaves.
+type treeNode struct {
+	label    string
+	color    string
+	count    int
+	children []*treeNode
+	index    map[string]*treeNode
+}
+
+// child returns the child labelled label, adding it if it is new.
+func (n *treeNode) child(label, color string) *treeNode {
+	if c, ok := n.index[label]; ok {
+		return c
+	}
+	c := &treeNode{label: label, color: color, index: map[string]*treeNode{}}
+	n.children = append(n.children, c)
+	n.index[label] = c
+	return c
+}
+
+// PrintTree writes results as an indented tree of API group, kind, namespace and instance
+// name, with the number of instances under each node:
+//
+//	cert-manager.io (3)
+//	├── Certificate (2)
+//	│   └── prod (2)
+//	│       ├── api-cert
+//	│       └── web-cert
+//	└── Issuer (1)
+//	    └── prod (1)
+//	        └── letsencrypt
+//
+// Groups, kinds and namespaces are sorted by name, or by count with o.SortByCount;
+// instances keep the order of results.
+func PrintTree(out io.Writer, results []scan.Result, o *Options) {
+	root := &treeNode{index: map[string]*treeNode{}}
+	for i := range results {
+		res := &results[i]
+		group := res.GVR.Group
+		if group == "" {
+			group = "core"
+		}
+		namespace := res.Namespace
+		if namespace == "" {
+			namespace = "(cluster-scoped)"
+		}
+		path := []*treeNode{root}
+		path = append(path, path[len(path)-1].child(group, colorMagenta))
+		path = append(path, path[len(path)-1].child(res.Kind, colorDefault))
+		path = append(path, path[len(path)-1].child(namespace, colorCyan))
+		// Instances are leaves, added even when two share a name across versions
+		path[len(path)-1].children = append(path[len(path)-1].children, &treeNode{label: res.InstanceName, color: nameColor(res)})
+		for _, n := range path {
+			n.count++
+		}
+	}
+	sortTree(root, o)
+	for _, c := range root.children {
+		printTreeNode(out, c, "", "", o)
+	}
+}
+
+// sortTree sorts the inner nodes under n as o says, leaving the instance leaves in order.
+func sortTree(n *treeNode, o *Options) {
+	if len(n.children) == 0 || n.children[0].index == nil {
+		return
+	}
+	labels := make([]string, len(n.children))
+	counts := make(map[string]int, len(n.children))
+	for i, c := range n.children {
+		labels[i] = c.label
+		counts[c.label] = c.count
+	}
+	o.sortKeys(labels, counts)
+	for i, label := range labels {
+		n.children[i] = n.index[label]
+	}
+	for _, c := range n.children {
+		sortTree(c, o)
+	}
+}
+
+// printTreeNode writes n after first, the connector for its own line, and its children
+// after prefix, the indentation continuing n's branch.
+func printTreeNode(out io.Writer, n *treeNode, first, prefix string, o *Options) {
+	label := n.label
+	if o.Colored {
+		label = paint(n.color, label)
+	}
+	if n.index != nil {
+		label = fmt.Sprintf("%s (%d)", label, n.count)
+	}
+	fmt.Fprintln(out, first+label)
+	for i, c := range n.children {
+		if i == len(n.children)-1 {
+			printTreeNode(out, c, prefix+"└── ", prefix+"    ", o)
+		} else {
+			printTreeNode(out, c, prefix+"├── ", prefix+"│   ", o)
+		}
+	}
+}
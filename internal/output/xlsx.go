@@ -0,0 +1,160 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"kgcr/internal/scan"
+)
+
+// SheetKeys are the values -sheet-by accepts: how -o xlsx splits instances into sheets.
+var SheetKeys = map[string]bool{"namespace": true, "group": true}
+
+// maxColumnWidth caps the width of xlsx columns sized to their content, in characters.
+const maxColumnWidth = 60
+
+// WriteXLSX writes the results to out as an Excel workbook. A Summary sheet counts the
+// instances of each CRD per namespace or API group, as sheetBy says, and is followed by
+// one sheet per namespace or group listing its instances with the given columns.
+func WriteXLSX(out io.Writer, results []scan.Result, sheetBy string, columns []Column, o *Options) error {
+	label, key := "Namespace", func(res *scan.Result) string {
+		if res.Namespace == "" {
+			return "(cluster-scoped)"
+		}
+		return res.Namespace
+	}
+	if sheetBy == "group" {
+		label, key = "API group", func(res *scan.Result) string {
+			if res.GVR.Group == "" {
+				return "(core)"
+			}
+			return res.GVR.Group
+		}
+	}
+	sheets := map[string][]*scan.Result{}
+	for i := range results {
+		k := key(&results[i])
+		sheets[k] = append(sheets[k], &results[i])
+	}
+	keys := make([]string, 0, len(sheets))
+	for k := range sheets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	f := excelize.NewFile()
+	defer f.Close()
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	// The new file's only sheet becomes the summary, so it opens first
+	if err := f.SetSheetName(f.GetSheetName(0), "Summary"); err != nil {
+		return err
+	}
+	rows := [][]interface{}{{label, "CRD", "Instances"}}
+	for _, k := range keys {
+		counts := map[string]int{}
+		for _, res := range sheets[k] {
+			counts[res.CRDName]++
+		}
+		crds := make([]string, 0, len(counts))
+		for crd := range counts {
+			crds = append(crds, crd)
+		}
+		sort.Strings(crds)
+		for _, crd := range crds {
+			rows = append(rows, []interface{}{k, crd, counts[crd]})
+		}
+	}
+	rows = append(rows, []interface{}{"Total", "", len(results)})
+	if err := writeSheet(f, "Summary", rows, bold, true); err != nil {
+		return err
+	}
+
+	used := map[string]bool{"summary": true}
+	for _, k := range keys {
+		rows := make([][]interface{}, 0, len(sheets[k])+1)
+		header := make([]interface{}, len(columns))
+		for i, c := range columns {
+			header[i] = c.name
+		}
+		rows = append(rows, header)
+		for _, res := range sheets[k] {
+			row := make([]interface{}, len(columns))
+			for i, c := range columns {
+				row[i] = c.value(o, res)
+			}
+			rows = append(rows, row)
+		}
+
+		name := sheetName(k, used)
+		if _, err := f.NewSheet(name); err != nil {
+			return err
+		}
+		if err := writeSheet(f, name, rows, bold, false); err != nil {
+			return err
+		}
+	}
+	return f.Write(out)
+}
+
+// writeSheet streams rows into sheet with a bold, frozen header row and columns sized to
+// their content. With boldLast, the last row, a total, is bold too.
+func writeSheet(f *excelize.File, sheet string, rows [][]interface{}, bold int, boldLast bool) error {
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, v := range row {
+			widths[i] = max(widths[i], min(len(fmt.Sprint(v))+2, maxColumnWidth))
+		}
+	}
+	for i, w := range widths {
+		if err := sw.SetColWidth(i+1, i+1, float64(w)); err != nil {
+			return err
+		}
+	}
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+	for r, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, r+1)
+		if err != nil {
+			return err
+		}
+		var opts []excelize.RowOpts
+		if r == 0 || boldLast && r == len(rows)-1 {
+			opts = append(opts, excelize.RowOpts{StyleID: bold})
+		}
+		if err := sw.SetRow(cell, row, opts...); err != nil {
+			return err
+		}
+	}
+	return sw.Flush()
+}
+
+// invalidSheetChars are the characters Excel does not allow in sheet names.
+var invalidSheetChars = strings.NewReplacer(":", "_", `\`, "_", "/", "_", "?", "_", "*", "_", "[", "_", "]", "_")
+
+// sheetName returns a valid, unused sheet name for name and marks it used. Excel limits
+// names to 31 characters and compares them case-insensitively, so long names are cut and
+// clashes get a ~2, ~3... suffix.
+func sheetName(name string, used map[string]bool) string {
+	const maxLen = 31
+	base := invalidSheetChars.Replace(name)
+	name = base[:min(len(base), maxLen)]
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		suffix := fmt.Sprintf("~%d", i)
+		name = base[:min(len(base), maxLen-len(suffix))] + suffix
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
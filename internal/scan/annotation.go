@@ -0,0 +1,31 @@
+package scan
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// annotationFilter keeps instances carrying an annotation, with a given value unless
+// anyValue is set. Operators often keep state such as paused or owner in annotations
+// rather than labels, which have no server-side selector.
+type annotationFilter struct {
+	key      string
+	value    string
+	anyValue bool
+}
+
+// NewAnnotationFilter keeps the instances whose annotation key is exactly value.
+func NewAnnotationFilter(key, value string) Filter {
+	return &annotationFilter{key: key, value: value}
+}
+
+// NewHasAnnotationFilter keeps the instances with annotation key, whatever its value.
+func NewHasAnnotationFilter(key string) Filter {
+	return &annotationFilter{key: key, anyValue: true}
+}
+
+func (f *annotationFilter) matches(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	value, ok := obj.GetAnnotations()[f.key]
+	return ok && (f.anyValue || value == f.value), nil
+}
@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/version"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/cel/environment"
+)
+
+// celFilter keeps instances for which a CEL expression evaluates to true.
+// The expression sees the instance as the "object" variable, like a ValidatingAdmissionPolicy.
+type celFilter struct {
+	expression string
+	program    cel.Program
+}
+
+// NewCELFilter compiles expression using the same base environment (function libraries,
+// language settings and cost limits) that the Kubernetes API server uses for CEL.
+func NewCELFilter(expression string) (Filter, error) {
+	envSet, err := environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion(), true).Extend(
+		environment.VersionedOptions{
+			IntroducedVersion: version.MajorMinor(1, 0),
+			EnvOptions:        []cel.EnvOption{cel.Variable("object", cel.DynType)},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("building CEL environment: %w", err)
+	}
+	env, err := envSet.Env(environment.NewExpressions)
+	if err != nil {
+		return nil, fmt.Errorf("building CEL environment: %w", err)
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("compiling CEL expression: %w", issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("CEL expression must evaluate to bool, got %s", ast.OutputType())
+	}
+
+	// The environment only bounds the cost estimated at compile time; like the API server,
+	// also stop an evaluation that runs past the per-call limit on a large instance.
+	program, err := env.Program(ast, cel.CostLimit(celconfig.PerCallLimit))
+	if err != nil {
+		return nil, fmt.Errorf("building CEL program: %w", err)
+	}
+	return &celFilter{expression: expression, program: program}, nil
+}
+
+func (f *celFilter) matches(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	out, _, err := f.program.ContextEval(ctx, map[string]interface{}{"object": obj.Object})
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.(types.Bool)
+	if !ok {
+		return false, fmt.Errorf("CEL expression %q returned %s, not bool", f.expression, out.Type())
+	}
+	return bool(result), nil
+}
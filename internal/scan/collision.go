@@ -0,0 +1,103 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// Collision is a Kind or plural resource name that CRDs in several API groups share,
+// e.g. two "certificates" resources. kubectl then resolves the short name to just one of
+// them, which confuses users and breaks scripts.
+type Collision struct {
+	Name  string   `json:"name"`  // the shared Kind or resource name
+	Field string   `json:"field"` // "kind" or "resource"
+	CRDs  []string `json:"crds"`  // the names of the CRDs sharing it, sorted
+}
+
+// FindCollisions returns the Kinds and resource names shared by CRDs in different API
+// groups, compared case-insensitively, sorted by field and name.
+func FindCollisions(crds []apiextensionsv1.CustomResourceDefinition) []Collision {
+	byField := map[string]map[string][]*apiextensionsv1.CustomResourceDefinition{"kind": {}, "resource": {}}
+	for i := range crds {
+		crd := &crds[i]
+		kind, resource := strings.ToLower(crd.Spec.Names.Kind), crd.Spec.Names.Plural
+		byField["kind"][kind] = append(byField["kind"][kind], crd)
+		byField["resource"][resource] = append(byField["resource"][resource], crd)
+	}
+
+	var collisions []Collision
+	for field, byName := range byField {
+		for _, shared := range byName {
+			groups := map[string]bool{}
+			for _, crd := range shared {
+				groups[crd.Spec.Group] = true
+			}
+			if len(groups) < 2 {
+				continue
+			}
+			c := Collision{Name: shared[0].Spec.Names.Plural, Field: field}
+			if field == "kind" {
+				c.Name = shared[0].Spec.Names.Kind
+			}
+			for _, crd := range shared {
+				c.CRDs = append(c.CRDs, crd.Name)
+			}
+			sort.Strings(c.CRDs)
+			collisions = append(collisions, c)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		if collisions[i].Field != collisions[j].Field {
+			return collisions[i].Field < collisions[j].Field
+		}
+		return strings.ToLower(collisions[i].Name) < strings.ToLower(collisions[j].Name)
+	})
+	return collisions
+}
+
+// ListCRDs lists the CRDs matching CRDSelector, through the CRD cache when it is set.
+func (s *Scanner) ListCRDs(ctx context.Context) ([]apiextensionsv1.CustomResourceDefinition, error) {
+	list, err := s.listCRDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing CRDs: %w", err)
+	}
+	return list.Items, nil
+}
+
+// kindSelected reports whether Kinds selects kind in group, given either as a bare Kind
+// or, to pick one of several groups sharing a Kind, as Kind.group like kubectl's
+// resource.group form.
+func (s *Scanner) kindSelected(kind, group string) bool {
+	kind = strings.ToLower(kind)
+	return s.Kinds[kind] || s.Kinds[kind+"."+group]
+}
+
+// KindMatches reports whether selector, a Kind or Kind.group as given to -by-kind, selects
+// kind in group, ignoring case like kindSelected.
+func KindMatches(selector, kind, group string) bool {
+	selector, kind = strings.ToLower(selector), strings.ToLower(kind)
+	return selector == kind || selector == kind+"."+group
+}
+
+// warnAmbiguousKinds warns about each bare Kind in Kinds that selects CRDs in several
+// groups, among the scanned ones.
+func (s *Scanner) warnAmbiguousKinds(jobs []crdJob) {
+	groups := map[string][]string{}
+	for _, job := range jobs {
+		kind := strings.ToLower(job.kind)
+		if s.Kinds[kind] {
+			groups[kind] = append(groups[kind], job.gvr.Group)
+		}
+	}
+	for kind, selected := range groups {
+		if len(selected) > 1 {
+			sort.Strings(selected)
+			slog.Warn("Kind matches CRDs in several API groups; use Kind.group to pick one", "kind", kind, "groups", strings.Join(selected, ","))
+		}
+	}
+}
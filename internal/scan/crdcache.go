@@ -0,0 +1,126 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var customResourceDefinitionsGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// listCRDs lists the CRDs matching CRDSelector. With a CRDCache file and a MetadataClient,
+// the full list is read from the cache as long as a metadata-only list shows the same CRDs
+// at the same resourceVersions; the metadata list skips the OpenAPI schemas that make a
+// full list of hundreds of CRDs slow.
+func (s *Scanner) listCRDs(ctx context.Context) (*apiextensionsv1.CustomResourceDefinitionList, error) {
+	if s.CRDCache == "" || s.MetadataClient == nil {
+		return s.APIExtensionsClient.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{LabelSelector: s.CRDSelector})
+	}
+
+	selector, err := labels.Parse(s.CRDSelector)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRD selector: %w", err)
+	}
+	current, err := s.MetadataClient.Resource(customResourceDefinitionsGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]string, len(current.Items))
+	for _, crd := range current.Items {
+		versions[crd.Name] = crd.ResourceVersion
+	}
+
+	list, err := readCRDCache(s.CRDCache)
+	if err != nil || !sameResourceVersions(list, versions) {
+		if err != nil && !os.IsNotExist(err) {
+			slog.Debug("ignoring unreadable CRD cache", "file", s.CRDCache, "error", err)
+		}
+		list, err = s.APIExtensionsClient.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeCRDCache(s.CRDCache, list); err != nil {
+			slog.Warn("writing CRD cache failed", "file", s.CRDCache, "error", err)
+		}
+	} else {
+		slog.Debug("using cached CRD list", "file", s.CRDCache, "crds", len(list.Items))
+	}
+
+	if selector.Empty() {
+		return list, nil
+	}
+	matching := &apiextensionsv1.CustomResourceDefinitionList{ListMeta: list.ListMeta}
+	for _, crd := range list.Items {
+		if selector.Matches(labels.Set(crd.Labels)) {
+			matching.Items = append(matching.Items, crd)
+		}
+	}
+	return matching, nil
+}
+
+// sameResourceVersions reports whether list holds exactly the CRDs in versions, each at
+// the given resourceVersion.
+func sameResourceVersions(list *apiextensionsv1.CustomResourceDefinitionList, versions map[string]string) bool {
+	if len(list.Items) != len(versions) {
+		return false
+	}
+	for _, crd := range list.Items {
+		if rv, ok := versions[crd.Name]; !ok || rv != crd.ResourceVersion {
+			return false
+		}
+	}
+	return true
+}
+
+func readCRDCache(file string) (*apiextensionsv1.CustomResourceDefinitionList, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := json.Unmarshal(data, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// writeCRDCache replaces the cache file atomically.
+func writeCRDCache(file string, list *apiextensionsv1.CustomResourceDefinitionList) error {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	// The same permissions kubectl uses for its discovery cache
+	return replaceCacheFile(file, data, 0o660)
+}
+
+// replaceCacheFile writes data to file atomically, with permissions perm.
+func replaceCacheFile(file string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,88 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+var apiServicesGVR = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+
+// aggregatedGroupVersions returns the group versions registered by APIServices that point at
+// a service, i.e. those served by an aggregated API server rather than kube-apiserver itself.
+func (s *Scanner) aggregatedGroupVersions(ctx context.Context) (map[string]bool, error) {
+	apiServices, err := s.DynamicClient.Resource(apiServicesGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing APIServices: %w", err)
+	}
+	groupVersions := map[string]bool{}
+	for _, apiService := range apiServices.Items {
+		service, _, _ := unstructured.NestedMap(apiService.Object, "spec", "service")
+		if service == nil {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(apiService.Object, "spec", "group")
+		version, _, _ := unstructured.NestedString(apiService.Object, "spec", "version")
+		groupVersions[schema.GroupVersion{Group: group, Version: version}.String()] = true
+	}
+	return groupVersions, nil
+}
+
+// aggregatedJobs uses the discovery API to find the listable namespaced resources served by
+// aggregated API servers, at their preferred version.
+func (s *Scanner) aggregatedJobs(ctx context.Context) ([]crdJob, error) {
+	aggregated, err := s.aggregatedGroupVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(aggregated) == 0 {
+		return nil, nil
+	}
+
+	// Aggregated servers that are down fail discovery for their group only; keep the rest
+	client := s.DiscoveryClient
+	if client == nil {
+		client = s.APIExtensionsClient.Discovery()
+	}
+	resourceLists, err := client.ServerPreferredNamespacedResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("discovering API resources: %w", err)
+	}
+
+	var jobs []crdJob
+	for _, list := range resourceLists {
+		if !aggregated[list.GroupVersion] {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			// Skip subresources and resources that cannot be listed
+			if strings.Contains(r.Name, "/") || !slices.Contains(r.Verbs, "list") {
+				continue
+			}
+			if s.Kinds != nil && !s.kindSelected(r.Kind, gv.Group) {
+				continue
+			}
+			if s.Category != "" && !slices.Contains(r.Categories, s.Category) {
+				continue
+			}
+			jobs = append(jobs, crdJob{
+				name:          r.Name + "." + gv.Group,
+				kind:          r.Kind,
+				source:        SourceAggregated,
+				storedVersion: gv.Version,
+				gvr:           gv.WithResource(r.Name),
+			})
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,80 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// establishedPollInterval is how often -wait-established checks the pending CRDs again.
+var establishedPollInterval = time.Second
+
+// establishedCondition returns crd's Established condition, or nil if it has none yet.
+func establishedCondition(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinitionCondition {
+	for i := range crd.Status.Conditions {
+		if crd.Status.Conditions[i].Type == apiextensionsv1.Established {
+			return &crd.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// isEstablished reports whether the API server serves crd's resources. Until then, as
+// right after an operator install, listing them fails.
+func isEstablished(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	c := establishedCondition(crd)
+	return c != nil && c.Status == apiextensionsv1.ConditionTrue
+}
+
+// waitEstablished polls the pending CRDs until they are Established or WaitEstablished
+// passes, and returns those that became Established and a problem for each of the others.
+func (s *Scanner) waitEstablished(ctx context.Context, pending []*apiextensionsv1.CustomResourceDefinition) ([]*apiextensionsv1.CustomResourceDefinition, []Problem) {
+	var ready []*apiextensionsv1.CustomResourceDefinition
+	if s.WaitEstablished > 0 {
+		slog.Info("waiting for CRDs to be Established", "crds", len(pending), "timeout", s.WaitEstablished)
+		waitCtx, cancel := context.WithTimeout(ctx, s.WaitEstablished)
+		defer cancel()
+		ticker := time.NewTicker(establishedPollInterval)
+		defer ticker.Stop()
+	poll:
+		for len(pending) > 0 {
+			select {
+			case <-waitCtx.Done():
+				break poll
+			case <-ticker.C:
+			}
+			var waiting []*apiextensionsv1.CustomResourceDefinition
+			for _, crd := range pending {
+				latest, err := s.APIExtensionsClient.ApiextensionsV1().CustomResourceDefinitions().Get(waitCtx, crd.Name, metav1.GetOptions{})
+				switch {
+				case err != nil:
+					slog.Debug("checking CRD failed", "crd", crd.Name, "error", err)
+					waiting = append(waiting, crd)
+				case isEstablished(latest):
+					slog.Debug("CRD is Established", "crd", crd.Name)
+					ready = append(ready, latest)
+				default:
+					waiting = append(waiting, latest)
+				}
+			}
+			pending = waiting
+		}
+	}
+
+	problems := make([]Problem, 0, len(pending))
+	for _, crd := range pending {
+		message := "skipped: not Established"
+		if s.WaitEstablished > 0 {
+			message += fmt.Sprintf(" after %s", s.WaitEstablished)
+		}
+		if c := establishedCondition(crd); c != nil && c.Reason != "" {
+			message += fmt.Sprintf(" (%s: %s)", c.Reason, c.Message)
+		}
+		problems = append(problems, Problem{CRD: crd.Name, Message: message})
+	}
+	return ready, problems
+}
@@ -0,0 +1,24 @@
+package scan
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Filter decides whether a custom resource instance is kept in the results.
+type Filter interface {
+	matches(ctx context.Context, obj *unstructured.Unstructured) (bool, error)
+}
+
+// MatchesAll reports whether obj passes every filter, as every instance a scan finds must.
+// An instance a filter cannot evaluate (e.g. a missing field) is treated as not matching.
+func MatchesAll(ctx context.Context, filters []Filter, obj *unstructured.Unstructured) bool {
+	for _, f := range filters {
+		ok, err := f.matches(ctx, obj)
+		if err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package scan
+
+import (
+	"context"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// GroupByKeys are the accepted -group-by values.
+var GroupByKeys = map[string]bool{"operator": true, "system": true}
+
+// partOfLabel is the recommended label naming the application, often an operator, a CRD belongs to.
+const partOfLabel = "app.kubernetes.io/part-of"
+
+// nameLabel is the recommended label naming the application an object is part of, when
+// it has no partOfLabel naming a larger one.
+const nameLabel = "app.kubernetes.io/name"
+
+// Group is one section of grouped output.
+type Group struct {
+	Name    string
+	Results []Result
+}
+
+// GroupByOperator attributes each result to the operator owning its CRD: the OLM
+// ClusterServiceVersion that owns it, else the CRD's app.kubernetes.io/part-of label, else
+// "<unknown>". Groups are sorted by name with "<unknown>" last, and keep the order of results.
+func (s *Scanner) GroupByOperator(ctx context.Context, results []Result) []Group {
+	owners := s.csvOwners(ctx)
+	operatorOf := func(res *Result) string {
+		if csv := owners[res.CRDName]; csv != "" {
+			return csv
+		}
+		if res.CRD != nil {
+			if partOf := res.CRD.GetLabels()[partOfLabel]; partOf != "" {
+				return partOf
+			}
+		}
+		return "<unknown>"
+	}
+	return groupResults(results, operatorOf)
+}
+
+// GroupBySystem groups results by the platform component, such as cert-manager or istio,
+// their instances belong to, as resolved into Result.System with ResolveSystems. Groups
+// are sorted by name and keep the order of results.
+func GroupBySystem(results []Result) []Group {
+	return groupResults(results, func(res *Result) string { return res.System })
+}
+
+// systemOf returns the platform component item belongs to: its app.kubernetes.io/part-of
+// label, else its app.kubernetes.io/name label, else its API group.
+func systemOf(item *unstructured.Unstructured, group string) string {
+	labels := item.GetLabels()
+	if partOf := labels[partOfLabel]; partOf != "" {
+		return partOf
+	}
+	if name := labels[nameLabel]; name != "" {
+		return name
+	}
+	return group
+}
+
+// groupResults groups results by the name nameOf gives each, sorted by name with
+// "<unknown>" last.
+func groupResults(results []Result, nameOf func(*Result) string) []Group {
+	index := map[string]int{}
+	var groups []Group
+	for i := range results {
+		name := nameOf(&results[i])
+		j, ok := index[name]
+		if !ok {
+			j = len(groups)
+			index[name] = j
+			groups = append(groups, Group{Name: name})
+		}
+		groups[j].Results = append(groups[j].Results, results[i])
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].Name == "<unknown>") != (groups[j].Name == "<unknown>") {
+			return groups[j].Name == "<unknown>"
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
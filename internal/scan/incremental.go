@@ -0,0 +1,290 @@
+package scan
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// incrementalWatchTimeout is how long the watch bringing a stored list up to date may
+// last. The API server sends a bookmark with its current resourceVersion about two
+// seconds before a watch times out, which ends it after a second or so unless a change
+// at or past the current resourceVersion ends it first.
+const incrementalWatchTimeout = 3 * time.Second
+
+// IncrementalState keeps every instance of each resource type listed by the previous
+// scan, unfiltered, with the resourceVersion they are current at, in a directory with a
+// file per resource type and namespace. A scan with it watches each resource type from
+// that resourceVersion for the changes up to the current one, instead of listing it again,
+// and lists it in full only the first time or when the API server no longer has changes
+// that old. Only the resource types being listed are held in memory at once.
+//
+// The files are full copies of the instances, including any credentials inlined in their
+// specs, so they are only readable by their owner.
+type IncrementalState struct {
+	dir    string
+	synced atomic.Int32
+}
+
+// incrementalList is one resource type's instances in one namespace, or in all of them.
+type incrementalList struct {
+	ResourceVersion string                                `json:"resourceVersion"`
+	Items           map[string]*unstructured.Unstructured `json:"items"` // by namespace/name
+}
+
+// NewIncrementalState returns the state kept in dir, which is created if needed.
+func NewIncrementalState(dir string) *IncrementalState {
+	return &IncrementalState{dir: dir}
+}
+
+// begin prepares st for a scan.
+func (st *IncrementalState) begin() {
+	if st == nil {
+		return
+	}
+	st.synced.Store(0)
+}
+
+// file returns the file keeping job's instances in namespace, or in all namespaces if it
+// is empty, e.g. widgets.example.com_v1_default.json.gz. Names of resources, groups and
+// namespaces cannot contain "_".
+func (st *IncrementalState) file(job crdJob, namespace string) string {
+	name := job.gvr.Resource + "." + job.gvr.Group + "_" + job.gvr.Version
+	if namespace != "" {
+		name += "_" + namespace
+	}
+	return filepath.Join(st.dir, name+".json.gz")
+}
+
+// load returns the list stored in file, or nil if there is none or it cannot be read.
+func (st *IncrementalState) load(file string) *incrementalList {
+	list, err := readIncrementalList(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Debug("ignoring unreadable incremental state", "file", file, "error", err)
+		}
+		return nil
+	}
+	if list.Items == nil {
+		list.Items = map[string]*unstructured.Unstructured{}
+	}
+	return list
+}
+
+func readIncrementalList(file string) (*incrementalList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	list := &incrementalList{}
+	if err := json.NewDecoder(zr).Decode(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// store replaces file with list, readable only by its owner.
+func (st *IncrementalState) store(file string, list *incrementalList) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(list); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(st.dir, 0o700); err != nil {
+		return err
+	}
+	return replaceCacheFile(file, buf.Bytes(), 0o600)
+}
+
+func itemKey(item *unstructured.Unstructured) string {
+	return item.GetNamespace() + "/" + item.GetName()
+}
+
+// listIncremental brings job's instances in each of s.namespaces up to date in the
+// Incremental state, by watching for changes or listing them in full, and sends the
+// matching results. It returns the instances and list or watch calls, and the first error.
+func (s *Scanner) listIncremental(ctx, spanCtx context.Context, job crdJob, now time.Time, results chan<- []Result) (items, calls int, err error) {
+	for _, namespace := range s.namespaces {
+		file := s.Incremental.file(job, namespace)
+		list := s.Incremental.load(file)
+		synced := false
+		if list != nil && list.ResourceVersion != "" {
+			var n int
+			synced, n, err = s.watchChanges(spanCtx, job, namespace, list)
+			calls += n
+			if err != nil {
+				return items, calls, err
+			}
+		}
+		if synced {
+			s.Incremental.synced.Add(1)
+		} else {
+			var pages int
+			list, pages, err = s.listAll(spanCtx, job, namespace)
+			calls += pages
+			if err != nil {
+				return items, calls, err
+			}
+		}
+		if err := s.Incremental.store(file, list); err != nil {
+			slog.Warn("saving incremental state failed", "file", file, "error", err)
+		}
+
+		items += len(list.Items)
+		var matching []Result
+		for _, item := range list.Items {
+			res, ok := s.newResult(spanCtx, job, item, now)
+			if !ok {
+				continue
+			}
+			if err := s.keepObject(&res, item); err != nil {
+				return items, calls, err
+			}
+			matching = append(matching, res)
+		}
+		if len(matching) > 0 {
+			select {
+			case results <- matching:
+			case <-ctx.Done():
+				return items, calls, ctx.Err()
+			}
+		}
+	}
+	return items, calls, nil
+}
+
+// watchChanges applies the changes to job's instances in namespace since list's
+// resourceVersion, watching from there until it reaches the current resourceVersion. It
+// returns false if the API server no longer has changes that old, and the list must be
+// redone, and the number of API calls made.
+func (s *Scanner) watchChanges(ctx context.Context, job crdJob, namespace string, list *incrementalList) (bool, int, error) {
+	// A one-item list is the cheapest way to learn the current resourceVersion
+	current, err := s.list(ctx, job, namespace, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return false, 1, err
+	}
+	target, comparable := parseResourceVersion(current.GetResourceVersion())
+	stored, ok := parseResourceVersion(list.ResourceVersion)
+	comparable = comparable && ok
+	if comparable && stored >= target {
+		slog.Debug("stored list is current", "crd", job.name, "namespace", namespace, "resourceVersion", list.ResourceVersion)
+		return true, 1, nil
+	}
+
+	seconds := int64(incrementalWatchTimeout / time.Second)
+	opts := metav1.ListOptions{ResourceVersion: list.ResourceVersion, AllowWatchBookmarks: true, TimeoutSeconds: &seconds}
+	reqCtx, cancel := context.WithTimeout(ctx, incrementalWatchTimeout+5*time.Second)
+	defer cancel()
+	reqCtx = context.WithValue(reqCtx, crdContextKey{}, job.name)
+
+	w, err := s.resourceClient(job, namespace).Watch(reqCtx, opts)
+	if isExpired(err) {
+		slog.Debug("stored resourceVersion expired; listing again", "crd", job.name, "namespace", namespace, "resourceVersion", list.ResourceVersion)
+		return false, 2, nil
+	}
+	if err != nil {
+		return false, 2, err
+	}
+	defer w.Stop()
+
+	// resourceVersions are global to the cluster, so the current one is rarely that of a
+	// change of this type: the replay usually ends at a bookmark. Only the resourceVersions
+	// actually delivered are stored, never one assumed to be reached.
+	changes := 0
+	for ev := range w.ResultChan() {
+		if ev.Type == watch.Error {
+			err := apierrors.FromObject(ev.Object)
+			if isExpired(err) {
+				slog.Debug("stored resourceVersion expired; listing again", "crd", job.name, "namespace", namespace, "resourceVersion", list.ResourceVersion)
+				return false, 2, nil
+			}
+			return false, 2, err
+		}
+		item, ok := ev.Object.(*unstructured.Unstructured)
+		if !ok {
+			return false, 2, fmt.Errorf("unexpected %T in watch of %s", ev.Object, job.name)
+		}
+		list.ResourceVersion = item.GetResourceVersion()
+		switch ev.Type {
+		case watch.Added, watch.Modified:
+			list.Items[itemKey(item)] = item
+			changes++
+		case watch.Deleted:
+			delete(list.Items, itemKey(item))
+			changes++
+		}
+		// Everything up to a bookmark or change at or past the current resourceVersion
+		// has been replayed
+		rv, ok := parseResourceVersion(list.ResourceVersion)
+		if (comparable && ok && rv >= target) || (!comparable && ev.Type == watch.Bookmark) {
+			slog.Debug("synced from stored resourceVersion", "crd", job.name, "namespace", namespace, "changes", changes)
+			return true, 2, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return false, 2, ctx.Err()
+	}
+	// The watch timed out without a bookmark, as on servers without a watch cache, after
+	// the changes up to list.ResourceVersion
+	slog.Debug("synced from stored resourceVersion", "crd", job.name, "namespace", namespace, "changes", changes)
+	return true, 2, nil
+}
+
+// parseResourceVersion returns resourceVersion as a number. The API server's are etcd
+// revisions, which only grow, but other servers may use any string.
+func parseResourceVersion(resourceVersion string) (uint64, bool) {
+	rv, err := strconv.ParseUint(resourceVersion, 10, 64)
+	return rv, err == nil
+}
+
+// isExpired reports whether err says a resourceVersion is older than the API server keeps
+// changes for.
+func isExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// listAll lists every instance of job's resource type in namespace, unfiltered, for the
+// Incremental state. It returns them with the number of pages listed.
+func (s *Scanner) listAll(ctx context.Context, job crdJob, namespace string) (*incrementalList, int, error) {
+	list := &incrementalList{Items: map[string]*unstructured.Unstructured{}}
+	opts := s.listOptions()
+	for pages := 1; ; pages++ {
+		resourceList, err := s.list(ctx, job, namespace, opts)
+		if err != nil {
+			return nil, pages, err
+		}
+		// The pages of a list are all at the resourceVersion of the first
+		if list.ResourceVersion == "" {
+			list.ResourceVersion = resourceList.GetResourceVersion()
+		}
+		for i := range resourceList.Items {
+			item := &resourceList.Items[i]
+			list.Items[itemKey(item)] = item
+		}
+		if resourceList.GetContinue() == "" {
+			return list, pages, nil
+		}
+		opts.Continue, opts.ResourceVersion = resourceList.GetContinue(), ""
+	}
+}
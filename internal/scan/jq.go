@@ -0,0 +1,97 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// JQQuery is a compiled jq program that runs against each custom resource instance.
+// It can be used as a filter (keep if any output is truthy) or to extract a column value.
+type JQQuery struct {
+	expression string
+	code       *gojq.Code
+}
+
+// NewJQQuery compiles expression to run with each instance's object, as served by the
+// API server, as its input. As a filter the instance is kept when any output is truthy,
+// that is neither false nor null, so an expression with no output drops it.
+func NewJQQuery(expression string) (*JQQuery, error) {
+	query, err := gojq.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("parsing jq expression: %w", err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("compiling jq expression: %w", err)
+	}
+	return &JQQuery{expression: expression, code: code}, nil
+}
+
+// run collects every output of the program for obj.
+func (q *JQQuery) run(ctx context.Context, obj *unstructured.Unstructured) ([]interface{}, error) {
+	// gojq normalizes numbers in place, so hand it a copy rather than the instance itself
+	input := runtime.DeepCopyJSON(obj.Object)
+
+	var outputs []interface{}
+	iter := q.code.RunWithContext(ctx, input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return nil, fmt.Errorf("jq expression %q: %w", q.expression, err)
+		}
+		outputs = append(outputs, v)
+	}
+	return outputs, nil
+}
+
+// matches keeps obj when any output is truthy in the jq sense (neither false nor null).
+func (q *JQQuery) matches(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	outputs, err := q.run(ctx, obj)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range outputs {
+		if v != nil && v != false {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// extract renders the outputs for obj as a single table cell.
+// Strings are printed raw like `jq -r`, other values as compact JSON, and multiple outputs are comma-separated.
+func (q *JQQuery) extract(ctx context.Context, obj *unstructured.Unstructured) (string, error) {
+	outputs, err := q.run(ctx, obj)
+	if err != nil {
+		return "", err
+	}
+
+	values := make([]string, 0, len(outputs))
+	for _, v := range outputs {
+		switch v := v.(type) {
+		case nil:
+			continue
+		case string:
+			values = append(values, v)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, string(b))
+		}
+	}
+	if len(values) == 0 {
+		return "<none>", nil
+	}
+	return strings.Join(values, ","), nil
+}
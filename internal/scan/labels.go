@@ -0,0 +1,17 @@
+package scan
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// missingLabels returns the required label keys that are not set (or empty) on obj.
+func missingLabels(obj *unstructured.Unstructured, required []string) []string {
+	labels := obj.GetLabels()
+	var missing []string
+	for _, key := range required {
+		if labels[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
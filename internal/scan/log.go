@@ -0,0 +1,9 @@
+package scan
+
+import "log/slog"
+
+// Log levels below slog.LevelDebug for the higher -v verbosities.
+const (
+	LevelTrace = slog.LevelDebug - 4 // -v 3: per-CRD progress
+	LevelAll   = slog.LevelDebug - 8 // -v 4: everything
+)
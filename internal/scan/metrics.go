@@ -0,0 +1,206 @@
+package scan
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// APIMetrics counts the HTTP requests the API clients make, wrapped around their transport,
+// and the requests their rate limiter held back.
+type APIMetrics struct {
+	mu         sync.Mutex
+	requests   int
+	throttled  int            // 429 Too Many Requests responses
+	byPath     map[string]int // requests per URL path, to count retries
+	waits      int            // requests delayed by the client-side QPS/Burst limiter
+	waitedTime time.Duration
+}
+
+func NewAPIMetrics() *APIMetrics {
+	return &APIMetrics{byPath: map[string]int{}}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// Wrap is a rest.Config WrapTransport that records every request made through rt.
+func (m *APIMetrics) Wrap(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := rt.RoundTrip(req)
+		m.mu.Lock()
+		m.requests++
+		m.byPath[req.URL.Path]++
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			m.throttled++
+		}
+		m.mu.Unlock()
+		return resp, err
+	})
+}
+
+// RateLimiter returns a rest.Config RateLimiter that records the requests limiter delays.
+func (m *APIMetrics) RateLimiter(limiter flowcontrol.RateLimiter) flowcontrol.RateLimiter {
+	return &countingLimiter{RateLimiter: limiter, m: m}
+}
+
+// countingLimiter counts the requests that found no token left and how long they waited.
+type countingLimiter struct {
+	flowcontrol.RateLimiter
+	m *APIMetrics
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	if l.TryAccept() {
+		return nil
+	}
+	start := time.Now()
+	err := l.RateLimiter.Wait(ctx)
+	l.m.mu.Lock()
+	l.m.waits++
+	l.m.waitedTime += time.Since(start)
+	l.m.mu.Unlock()
+	return err
+}
+
+// totals returns the number of requests made and how many were throttled, by the API
+// server with a 429 and by the client's own rate limiter.
+// A nil m, as for clients built without Wrap, made no requests that were counted.
+func (m *APIMetrics) totals() (requests, throttled, waits int, waited time.Duration) {
+	if m == nil {
+		return 0, 0, 0, 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests, m.throttled, m.waits, m.waitedTime
+}
+
+// pathRequests returns how many requests were made to path.
+func (m *APIMetrics) pathRequests(path string) int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.byPath[path]
+}
+
+// crdTiming is how listing the instances of one CRD went, recorded with -debug.
+type crdTiming struct {
+	crd      string
+	duration time.Duration
+	items    int
+	retries  int
+	err      error
+}
+
+// printTimings writes the per-CRD timings, slowest first.
+func printTimings(out io.Writer, timings []crdTiming) {
+	sort.Slice(timings, func(i, j int) bool { return timings[i].duration > timings[j].duration })
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "CRD\tDURATION\tITEMS\tRETRIES\tERROR")
+	for _, t := range timings {
+		errText := ""
+		if t.err != nil {
+			errText = t.err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", t.crd, t.duration.Round(time.Millisecond), t.items, t.retries, errText)
+	}
+	w.Flush()
+}
+
+// Stats summarizes one scan, printed with -stats.
+type Stats struct {
+	CRDs          int           `json:"crds"`          // CRDs in the cluster
+	ResourceTypes int           `json:"resourceTypes"` // CRDs and aggregated resources scanned
+	Skipped       int           `json:"skipped"`       // CRDs skipped as cluster-scoped or filtered out
+	ListErrors    int           `json:"listErrors"`    // resource types whose list call failed
+	Instances     int           `json:"instances"`     // instances found after filtering
+	Requests      int           `json:"requests"`      // API requests made
+	Throttled     int           `json:"throttled"`     // 429 Too Many Requests responses
+	ClientWaits   int           `json:"clientWaits"`   // requests delayed by the client-side -qps/-burst limit
+	ClientWaited  time.Duration `json:"clientWaitedNanos"`
+	WallTime      time.Duration `json:"wallTimeNanos"`
+	PeakWorkers   int           `json:"peakWorkers"`      // most list calls in flight at once
+	Synced        int           `json:"synced,omitempty"` // lists brought up to date by a watch with -incremental
+	Problems      []Problem     `json:"problems,omitempty"`
+
+	// ListFailures are the resource types counted in ListErrors, with their errors; unlike
+	// Problems they are only logged at debug level, as limited RBAC can cause many
+	ListFailures []Problem `json:"listFailures,omitempty"`
+
+	// Warnings are the warning headers the API server returned, by CRD
+	Warnings []APIWarning `json:"warnings,omitempty"`
+
+	// Latencies is how long listing each resource type took, by CRD name
+	Latencies map[string]time.Duration `json:"-"`
+}
+
+// Problem is a resource type that could not be scanned as expected, reported in the
+// stats and logged as a warning rather than only in the debug log.
+type Problem struct {
+	CRD     string `json:"crd"`
+	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"` // API status reason of a failed call, e.g. Forbidden
+}
+
+// print writes the stats as an aligned block.
+func (st *Stats) print(out io.Writer) {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "CRDs in cluster:\t%d\n", st.CRDs)
+	fmt.Fprintf(w, "Resource types scanned:\t%d\n", st.ResourceTypes)
+	fmt.Fprintf(w, "CRDs skipped:\t%d\n", st.Skipped)
+	fmt.Fprintf(w, "List errors:\t%d\n", st.ListErrors)
+	fmt.Fprintf(w, "Instances found:\t%d\n", st.Instances)
+	fmt.Fprintf(w, "API requests:\t%d\n", st.Requests)
+	fmt.Fprintf(w, "Throttled (429):\t%d\n", st.Throttled)
+	fmt.Fprintf(w, "Throttled (client-side):\t%d (%s waited)\n", st.ClientWaits, st.ClientWaited.Round(time.Millisecond))
+	fmt.Fprintf(w, "Wall time:\t%s\n", st.WallTime.Round(time.Millisecond))
+	fmt.Fprintf(w, "Peak concurrency:\t%d\n", st.PeakWorkers)
+	if st.Synced > 0 {
+		fmt.Fprintf(w, "Synced by watch:\t%d\n", st.Synced)
+	}
+	fmt.Fprintf(w, "Problems:\t%d\n", len(st.Problems))
+	fmt.Fprintf(w, "API warnings:\t%d\n", len(st.Warnings))
+	w.Flush()
+	for _, p := range st.Problems {
+		fmt.Fprintf(out, "  %s: %s\n", p.CRD, p.Message)
+	}
+	for _, warning := range st.Warnings {
+		fmt.Fprintf(out, "  warning for %s: %s (%d responses)\n", cmp.Or(warning.CRD, "CRD list"), warning.Text, warning.Count)
+	}
+}
+
+// workerGauge tracks how many list calls are in flight and the most seen at once.
+type workerGauge struct {
+	mu      sync.Mutex
+	current int
+	peak    int
+}
+
+func (g *workerGauge) inc() {
+	g.mu.Lock()
+	g.current++
+	if g.current > g.peak {
+		g.peak = g.current
+	}
+	g.mu.Unlock()
+}
+
+func (g *workerGauge) dec() {
+	g.mu.Lock()
+	g.current--
+	g.mu.Unlock()
+}
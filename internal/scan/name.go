@@ -0,0 +1,23 @@
+package scan
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// nameFilter keeps instances whose name contains a partial name, case-insensitively.
+// Running it as a filter leaves the other instances out before their objects are kept.
+type nameFilter struct {
+	partial string
+}
+
+// NewNameFilter keeps the instances whose name contains partial, whatever its case.
+func NewNameFilter(partial string) Filter {
+	return &nameFilter{partial: strings.ToLower(partial)}
+}
+
+func (f *nameFilter) matches(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	return strings.Contains(strings.ToLower(obj.GetName()), f.partial), nil
+}
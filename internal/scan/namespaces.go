@@ -0,0 +1,62 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// Namespaces returns the names of the namespaces matching the label selector, sorted.
+func (s *Scanner) Namespaces(ctx context.Context, selector string) ([]string, error) {
+	list, err := s.DynamicClient.Resource(namespacesGVR).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("listing namespaces: %w", err)
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, ns := range list.Items {
+		names = append(names, ns.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// targetNamespaces returns the namespaces to list each resource type in, with "" for all
+// of them: those matching NamespaceRegex, when set, every namespace with PerNamespace,
+// else Namespace.
+func (s *Scanner) targetNamespaces(ctx context.Context) ([]string, error) {
+	if s.NamespaceRegex == nil {
+		if s.AllNamespaces && s.PerNamespace {
+			names, err := s.Namespaces(ctx, "")
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("listing namespace by namespace", "namespaces", len(names))
+			return names, nil
+		}
+		if s.AllNamespaces {
+			return []string{""}, nil
+		}
+		return []string{s.Namespace}, nil
+	}
+	names, err := s.Namespaces(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var matching []string
+	for _, name := range names {
+		if s.NamespaceRegex.MatchString(name) {
+			matching = append(matching, name)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("no namespace matches %q", s.NamespaceRegex)
+	}
+	slog.Info("resolved namespaces", "regex", s.NamespaceRegex.String(), "namespaces", len(matching))
+	return matching, nil
+}
@@ -0,0 +1,58 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var clusterServiceVersionsGVR = schema.GroupVersionResource{Group: "operators.coreos.com", Version: "v1alpha1", Resource: "clusterserviceversions"}
+
+// ownedCRDs returns the names of the CRDs owned by the OLM ClusterServiceVersion csv. OLM
+// copies a CSV into every namespace its operator watches, so all namespaces are searched.
+func (s *Scanner) ownedCRDs(ctx context.Context, csv string) (map[string]bool, error) {
+	csvs, err := s.DynamicClient.Resource(clusterServiceVersionsGVR).List(ctx, metav1.ListOptions{FieldSelector: "metadata.name=" + csv})
+	if err != nil {
+		return nil, fmt.Errorf("listing ClusterServiceVersions: %w", err)
+	}
+	if len(csvs.Items) == 0 {
+		return nil, fmt.Errorf("ClusterServiceVersion %q not found", csv)
+	}
+
+	owned := map[string]bool{}
+	for _, item := range csvs.Items {
+		crds, _, _ := unstructured.NestedSlice(item.Object, "spec", "customresourcedefinitions", "owned")
+		for _, c := range crds {
+			if crd, ok := c.(map[string]interface{}); ok {
+				if name, _ := crd["name"].(string); name != "" {
+					owned[name] = true
+				}
+			}
+		}
+	}
+	return owned, nil
+}
+
+// csvOwners maps each CRD name to the ClusterServiceVersion that owns it. It returns an
+// empty map on clusters without OLM.
+func (s *Scanner) csvOwners(ctx context.Context) map[string]string {
+	owners := map[string]string{}
+	csvs, err := s.DynamicClient.Resource(clusterServiceVersionsGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return owners
+	}
+	for _, item := range csvs.Items {
+		crds, _, _ := unstructured.NestedSlice(item.Object, "spec", "customresourcedefinitions", "owned")
+		for _, c := range crds {
+			if crd, ok := c.(map[string]interface{}); ok {
+				if name, _ := crd["name"].(string); name != "" {
+					owners[name] = item.GetName()
+				}
+			}
+		}
+	}
+	return owners
+}
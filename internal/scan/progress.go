@@ -0,0 +1,68 @@
+package scan
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progress redraws a one-line "scanned 143/312 CRDs, 892 instances found" status on a
+// terminal while the instances are listed, so long scans don't sit silent.
+type progress struct {
+	total     int
+	done      atomic.Int64
+	instances atomic.Int64
+
+	stop     chan struct{}
+	finished chan struct{}
+	once     sync.Once
+}
+
+// startProgress starts redrawing the status to w until finish is called.
+func startProgress(w io.Writer, total int) *progress {
+	p := &progress{total: total, stop: make(chan struct{}), finished: make(chan struct{})}
+	go p.run(w)
+	return p
+}
+
+func (p *progress) run(w io.Writer) {
+	defer close(p.finished)
+	spinner := `|/-\`
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		select {
+		case <-p.stop:
+			// Clear the line so the results start on a clean one
+			fmt.Fprint(w, "\r\033[K")
+			return
+		case <-ticker.C:
+			fmt.Fprintf(w, "\r\033[K%c scanned %d/%d CRDs, %d instances found",
+				spinner[frame%len(spinner)], p.done.Load(), p.total, p.instances.Load())
+		}
+	}
+}
+
+// crdDone counts one more resource type as listed. A nil p is a no-op.
+func (p *progress) crdDone() {
+	if p != nil {
+		p.done.Add(1)
+	}
+}
+
+// found counts n more instances. A nil p is a no-op.
+func (p *progress) found(n int) {
+	if p != nil {
+		p.instances.Add(int64(n))
+	}
+}
+
+// finish stops redrawing and clears the status line. It may be called more than once.
+func (p *progress) finish() {
+	if p != nil {
+		p.once.Do(func() { close(p.stop) })
+		<-p.finished
+	}
+}
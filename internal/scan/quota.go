@@ -0,0 +1,78 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var resourceQuotasGVR = schema.GroupVersionResource{Version: "v1", Resource: "resourcequotas"}
+
+// QuotaLimit is an object-count limit a ResourceQuota sets on a scanned CRD, from a
+// count/<resource>.<group> entry in its spec.hard.
+type QuotaLimit struct {
+	Namespace string
+	Quota     string // name of the ResourceQuota
+	CRD       string
+	Hard      int64
+	// Used is the count in the quota's status, -1 when the quota controller has not
+	// reported one yet
+	Used int64
+}
+
+// QuotaLimits lists the ResourceQuotas in the scanned namespaces and returns their
+// object-count limits on the CRDs of the last Scan.
+func (s *Scanner) QuotaLimits(ctx context.Context) ([]QuotaLimit, error) {
+	crds := map[string]bool{}
+	for _, crd := range s.CRDs {
+		crds[crd.Name] = true
+	}
+	namespaces, err := s.targetNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var limits []QuotaLimit
+	for _, ns := range namespaces {
+		list, err := s.DynamicClient.Resource(resourceQuotasGVR).Namespace(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("listing resource quotas: %w", err)
+		}
+		for i := range list.Items {
+			limits = append(limits, quotaLimits(&list.Items[i], crds)...)
+		}
+	}
+	return limits, nil
+}
+
+// quotaLimits returns the object-count limits of quota on the given CRDs.
+func quotaLimits(quota *unstructured.Unstructured, crds map[string]bool) []QuotaLimit {
+	// Quantities are strings from the API server, but manifests may hold plain numbers
+	hard, _, _ := unstructured.NestedMap(quota.Object, "spec", "hard")
+	used, _, _ := unstructured.NestedMap(quota.Object, "status", "used")
+	var limits []QuotaLimit
+	for key, value := range hard {
+		crd, ok := strings.CutPrefix(key, "count/")
+		if !ok || !crds[crd] {
+			continue
+		}
+		q, err := resource.ParseQuantity(fmt.Sprint(value))
+		if err != nil {
+			slog.Debug("skipping invalid quota", "namespace", quota.GetNamespace(), "quota", quota.GetName(), "resource", key, "error", err)
+			continue
+		}
+		limit := QuotaLimit{Namespace: quota.GetNamespace(), Quota: quota.GetName(), CRD: crd, Hard: q.Value(), Used: -1}
+		if u, ok := used[key]; ok {
+			if u, err := resource.ParseQuantity(fmt.Sprint(u)); err == nil {
+				limit.Used = u.Value()
+			}
+		}
+		limits = append(limits, limit)
+	}
+	return limits
+}
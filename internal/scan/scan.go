@@ -0,0 +1,880 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+)
+
+// ErrNoNamespacedCRDs is returned by Scan when the cluster has no namespaced CRDs at all.
+var ErrNoNamespacedCRDs = errors.New("no namespaced custom resources found in cluster")
+
+// Result is one custom resource instance found by a scan.
+type Result struct {
+	CRDName      string
+	ResourceName string
+	InstanceName string
+	Namespace    string
+	UID          string
+	JQValue      string // Output of the -jq expression in column mode
+	GVR          schema.GroupVersionResource
+	Kind         string
+	Source       string                                    // SourceCRD or SourceAggregated
+	CRD          *apiextensionsv1.CustomResourceDefinition // nil for aggregated API resources
+	Size         int                                       // Serialized size in bytes, only set when the scanner computes it
+	Created      time.Time
+
+	// Unhealthy and StuckDeleting drive the colors of the NAME column
+	Unhealthy     bool
+	StuckDeleting bool
+
+	// Annotations holds the values of the -show-annotations keys
+	Annotations map[string]string
+
+	// MissingLabels are the -require-labels keys this instance lacks
+	MissingLabels []string
+
+	// System is the platform component the instance belongs to, from its part-of or name
+	// label or else its API group; only set with Scanner.ResolveSystems
+	System string
+
+	// Object is the full instance, only kept when the scanner needs it (KeepObjects) and
+	// has no Spool; read it with LoadObject
+	Object  *unstructured.Unstructured
+	spooled spoolRef
+}
+
+// LoadObject returns the full instance, reading it back from the scanner's Spool if it was
+// written there. It returns nil if the scan did not keep objects.
+func (res *Result) LoadObject() (*unstructured.Unstructured, error) {
+	if res.Object != nil || res.spooled.spool == nil {
+		return res.Object, nil
+	}
+	return res.spooled.spool.read(res.spooled)
+}
+
+// Sources a resource type can come from, shown in the SOURCE column.
+const (
+	SourceCRD        = "crd"
+	SourceAggregated = "aggregated"
+)
+
+type crdJob struct {
+	name          string // CRD name, or resource.group for aggregated API resources
+	kind          string
+	source        string
+	crd           *apiextensionsv1.CustomResourceDefinition // nil for aggregated API resources
+	storedVersion string                                    // Pre-compute stored version, or a served one if it is not
+	gvr           schema.GroupVersionResource               // Pre-compute GVR
+}
+
+// Scanner lists the instances of every namespaced CRD in the cluster.
+// Only the two clients are required; tests inject the fake clientsets from client-go and
+// apiextensions-apiserver.
+type Scanner struct {
+	// APIExtensionsClient lists CRDs and, with Discovery, serves the discovery API
+	APIExtensionsClient apiextensionsclientset.Interface
+	// DynamicClient lists the instances, APIServices and OLM ClusterServiceVersions
+	DynamicClient dynamic.Interface
+	// DiscoveryClient finds aggregated API resources; nil uses APIExtensionsClient's
+	DiscoveryClient discovery.DiscoveryInterface
+
+	// CRDCache is a file caching the full CRD list, revalidated on every scan against the
+	// resourceVersions in a metadata-only list from MetadataClient; empty disables it
+	CRDCache       string
+	MetadataClient metadata.Interface
+
+	// Cluster names what is scanned: the API server URL, or the manifests read offline
+	Cluster string
+
+	Namespace     string
+	AllNamespaces bool
+	Filters       []Filter
+	Kinds         map[string]bool // lower-cased Kinds to scan; nil scans every CRD
+	Category      string          // only scan CRDs in this category, when set
+	CRDSelector   string          // label selector for the CRD list call
+	Operator      string          // only scan CRDs owned by this OLM ClusterServiceVersion, when set
+	JQColumn      *JQQuery
+	RequireLabels []string
+	ComputeSize   bool
+
+	// NamespaceRegex limits the scan to the namespaces whose names match it. They are
+	// resolved before listing and listed one by one, instead of across all namespaces.
+	NamespaceRegex *regexp.Regexp
+	namespaces     []string
+
+	// PerNamespace lists each resource type namespace by namespace, up to
+	// namespaceFanOut at once, instead of in one cluster-wide list. On clusters where
+	// cluster-wide lists of huge CRDs time out under API Priority and Fairness, many
+	// small lists finish where one large one does not. It cannot be combined with
+	// LimitPerCRD, which counts instances in namespace order.
+	PerNamespace bool
+
+	// Incremental keeps every instance listed between scans on disk, when set, and brings
+	// them up to date by watching from the resourceVersion of the previous scan. It cannot
+	// be combined with LimitPerCRD or PerNamespace.
+	Incremental *IncrementalState
+
+	// WaitEstablished is how long to wait for CRDs that are not yet Established, as right
+	// after an operator install; 0 skips them at once. Either way, those still not
+	// Established are skipped and reported in Stats.Problems.
+	WaitEstablished time.Duration
+
+	// Discovery adds namespaced resources served by aggregated API servers, found through
+	// the discovery API, to the CRDs listed from apiextensions
+	Discovery bool
+
+	// ShowAnnotations are the annotation keys whose values are copied onto each result
+	ShowAnnotations []string
+
+	// ResolveSystems sets each result's System, for GroupBySystem
+	ResolveSystems bool
+
+	// SizeWarning is the serialized size at which an instance is flagged as near the request
+	// size limit; with NearLimitOnly, smaller instances are dropped
+	SizeWarning   int
+	NearLimitOnly bool
+
+	// Warnings collects the API server's warning headers by CRD into Stats.Warnings, when
+	// set as the clients' warning handler; with ShowWarnings, they are logged after the scan
+	Warnings     *WarningRecorder
+	ShowWarnings bool
+
+	// Metrics counts the API requests made by the clients, when set; with Debug, each CRD's
+	// list call is timed into timings and printed to stderr after the scan
+	Metrics   *APIMetrics
+	Debug     bool
+	timingsMu sync.Mutex
+	timings   []crdTiming
+
+	// Stats summarizes the last scan; with PrintStats it is also written to stderr
+	Stats      Stats
+	PrintStats bool
+	inFlight   workerGauge
+	listErrors atomic.Int32
+	failuresMu sync.Mutex
+
+	// CRDs are the CRDs whose instances the last scan listed
+	CRDs []*apiextensionsv1.CustomResourceDefinition
+	// Collisions are the Kinds and resource names shared across API groups by the CRDs
+	// in the cluster, cluster-scoped ones included, found by the last scan
+	Collisions []Collision
+
+	// CPUProfile and MemProfile are files to write Go profiles of the scan to, when set
+	CPUProfile string
+	MemProfile string
+
+	// TracerProvider is set with -otel-endpoint and flushed after each scan
+	TracerProvider *sdktrace.TracerProvider
+
+	// Progress redraws a "scanned 143/312 CRDs" status line on stderr while listing
+	Progress bool
+	progress *progress
+
+	// KeepObjects retains the full unstructured instance on each result for commands that
+	// inspect content. With a Spool, the instances are written to it instead of memory.
+	KeepObjects bool
+	Spool       *Spool
+
+	// OnResults is called with each page of matching instances as soon as it is listed,
+	// in no particular order and from one goroutine at a time, for output that streams
+	// while the scan runs; Scan still returns every result
+	OnResults func(results []Result)
+
+	// ChunkSize is the number of instances requested per list call; 0 lists each resource
+	// type in a single call
+	ChunkSize int64
+
+	// FromCache lists with resourceVersion=0, which the API server answers from its watch
+	// cache instead of a quorum read from etcd: much cheaper, but possibly slightly stale
+	FromCache bool
+
+	// ServerTimeout asks the API server to end each list call after this long, rounded up
+	// to whole seconds, on top of the client-side timeout; 0 leaves it to the server
+	ServerTimeout time.Duration
+
+	// LimitPerCRD stops listing a resource type after this many matching instances, when
+	// set. Overflow records how many more each truncated one has, or MoreUnknown.
+	LimitPerCRD int64
+	Overflow    map[string]int
+	overflowMu  sync.Mutex
+}
+
+// MoreUnknown marks a resource type in Scanner.Overflow whose remaining instances were not
+// counted, because the server did not report a count or filters would apply to them.
+const MoreUnknown = -1
+
+// Scan lists all CRDs, fans the namespaced ones out to a worker pool and returns the
+// matching instances sorted by CRD name, resource name, namespace and instance name.
+func (s *Scanner) Scan(ctx context.Context) ([]Result, error) {
+	if s.CPUProfile != "" {
+		stop, err := startCPUProfile(s.CPUProfile)
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+	}
+	if s.MemProfile != "" {
+		defer func() {
+			if err := writeHeapProfile(s.MemProfile); err != nil {
+				slog.Warn("writing memory profile failed", "error", err)
+			}
+		}()
+	}
+
+	ctx, span := tracer.Start(ctx, "scan", trace.WithAttributes(
+		attribute.String("namespace", s.Namespace),
+		attribute.Bool("allNamespaces", s.AllNamespaces),
+	))
+	results, err := s.scanResources(ctx)
+	span.SetAttributes(attribute.Int("instances", len(results)))
+	endSpan(span, err)
+
+	if s.TracerProvider != nil {
+		if err := s.TracerProvider.ForceFlush(context.Background()); err != nil {
+			slog.Warn("exporting traces failed", "error", err)
+		}
+	}
+	return results, err
+}
+
+func (s *Scanner) scanResources(ctx context.Context) ([]Result, error) {
+	start := time.Now()
+	s.Warnings.reset()
+	s.Incremental.begin()
+
+	namespacedCRDs, err := s.resourceJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("scanning custom resources", "resourceTypes", len(namespacedCRDs), "crds", s.Stats.CRDs, "namespace", s.Namespace)
+
+	// Create buffered channels for better throughput
+	jobs := make(chan crdJob, len(namespacedCRDs))
+	results := make(chan []Result, len(namespacedCRDs))
+
+	// Determine optimal number of workers
+	numWorkers := runtime.NumCPU() * 3
+	if numWorkers > len(namespacedCRDs) {
+		numWorkers = len(namespacedCRDs)
+	}
+	if numWorkers > 20 {
+		numWorkers = 20 // Cap at 20 to avoid overwhelming the API server
+	}
+
+	ctx, listSpan := tracer.Start(ctx, "list instances", trace.WithAttributes(
+		attribute.Int("resourceTypes", len(namespacedCRDs)),
+		attribute.Int("workers", numWorkers),
+	))
+	defer listSpan.End()
+
+	s.progress = nil
+	if s.Progress {
+		s.progress = startProgress(os.Stderr, len(namespacedCRDs))
+		defer s.progress.finish()
+	}
+
+	// Start worker goroutines
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go s.crdWorker(ctx, w, jobs, results, &wg)
+	}
+
+	// Send jobs to workers
+	for _, job := range namespacedCRDs {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			close(jobs)
+			return nil, fmt.Errorf("timeout while sending jobs: %w", ctx.Err())
+		}
+	}
+	close(jobs)
+
+	// Wait for all workers to finish
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Pre-allocate result slice with estimated capacity
+	allResults := make([]Result, 0, len(namespacedCRDs)*10)
+
+	// Collect all results
+	for workerResults := range results {
+		if s.OnResults != nil {
+			s.OnResults(workerResults)
+		}
+		allResults = append(allResults, workerResults...)
+		s.progress.found(len(workerResults))
+	}
+	s.progress.finish()
+
+	if s.Debug {
+		printTimings(os.Stderr, s.timings)
+	}
+
+	s.Stats.ResourceTypes = len(namespacedCRDs)
+	s.Stats.ListErrors = int(s.listErrors.Load())
+	s.Stats.Instances = len(allResults)
+	s.Stats.Requests, s.Stats.Throttled, s.Stats.ClientWaits, s.Stats.ClientWaited = s.Metrics.totals()
+	s.Stats.WallTime = time.Since(start)
+	s.Stats.PeakWorkers = s.inFlight.peak
+	s.Stats.Warnings = s.Warnings.warnings()
+	if s.Incremental != nil {
+		s.Stats.Synced = int(s.Incremental.synced.Load())
+	}
+	if s.ShowWarnings {
+		s.logWarnings()
+	}
+	if s.PrintStats {
+		s.Stats.print(os.Stderr)
+	}
+
+	SortDefault(allResults)
+	return allResults, nil
+}
+
+// SortDefault sorts results alphabetically by CRD name, then by resource name, then by
+// namespace and instance name.
+func SortDefault(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].CRDName != results[j].CRDName {
+			return results[i].CRDName < results[j].CRDName
+		}
+		if results[i].ResourceName != results[j].ResourceName {
+			return results[i].ResourceName < results[j].ResourceName
+		}
+		if results[i].Namespace != results[j].Namespace {
+			return results[i].Namespace < results[j].Namespace
+		}
+		return results[i].InstanceName < results[j].InstanceName
+	})
+}
+
+// resourceJobs lists the CRDs and returns a job for each namespaced resource type to
+// scan, resetting Stats and resolving the namespaces to list them in.
+func (s *Scanner) resourceJobs(ctx context.Context) ([]crdJob, error) {
+	// List all CRDs in the cluster ---
+	listCtx, span := tracer.Start(ctx, "list CRDs")
+	crdList, err := s.listCRDs(listCtx)
+	endSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("listing CRDs: %w", err)
+	}
+
+	var ownedCRDs map[string]bool
+	if s.Operator != "" {
+		ownedCRDs, err = s.ownedCRDs(ctx, s.Operator)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Pre-process CRDs and filter out cluster-scoped resources
+	var namespacedCRDs []crdJob
+	var notEstablished []*apiextensionsv1.CustomResourceDefinition
+	var problems []Problem
+	addJob := func(crd *apiextensionsv1.CustomResourceDefinition) {
+		version, problem := listVersion(crd)
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+		if version != "" {
+			namespacedCRDs = append(namespacedCRDs, newCRDJob(crd, version))
+		}
+	}
+	for i := range crdList.Items {
+		crd := &crdList.Items[i]
+		// Skip cluster-scoped resources
+		if crd.Spec.Scope != "Namespaced" {
+			continue
+		}
+
+		if s.Kinds != nil && !s.kindSelected(crd.Spec.Names.Kind, crd.Spec.Group) {
+			continue
+		}
+		if s.Category != "" && !slices.Contains(crd.Spec.Names.Categories, s.Category) {
+			continue
+		}
+		if ownedCRDs != nil && !ownedCRDs[crd.Name] {
+			continue
+		}
+
+		if getStoredVersion(crd) == "" {
+			continue
+		}
+		// Listing a CRD's resources fails until the API server serves them
+		if !isEstablished(crd) {
+			notEstablished = append(notEstablished, crd)
+			continue
+		}
+		addJob(crd)
+	}
+
+	if len(notEstablished) > 0 {
+		ready, skipped := s.waitEstablished(ctx, notEstablished)
+		for _, crd := range ready {
+			addJob(crd)
+		}
+		problems = append(problems, skipped...)
+	}
+	for _, p := range problems {
+		slog.Warn("CRD not scanned as expected", "crd", p.CRD, "problem", p.Message)
+	}
+
+	s.Stats = Stats{CRDs: len(crdList.Items), Skipped: len(crdList.Items) - len(namespacedCRDs), Problems: problems, Latencies: map[string]time.Duration{}}
+	s.listErrors.Store(0)
+	s.timings = nil
+	s.Overflow = nil
+	s.CRDs = s.CRDs[:0]
+	for _, job := range namespacedCRDs {
+		s.CRDs = append(s.CRDs, job.crd)
+	}
+	s.Collisions = FindCollisions(crdList.Items)
+
+	// Aggregated API resources have no CRD for a -crd-selector or -operator to match
+	if s.Discovery && s.CRDSelector == "" && s.Operator == "" {
+		discoverCtx, span := tracer.Start(ctx, "discover aggregated APIs")
+		aggregated, err := s.aggregatedJobs(discoverCtx)
+		endSpan(span, err)
+		if err != nil {
+			return nil, err
+		}
+		namespacedCRDs = append(namespacedCRDs, aggregated...)
+	}
+
+	if s.Kinds != nil {
+		s.warnAmbiguousKinds(namespacedCRDs)
+	}
+	if len(namespacedCRDs) == 0 {
+		return nil, ErrNoNamespacedCRDs
+	}
+
+	s.namespaces, err = s.targetNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return namespacedCRDs, nil
+}
+
+// crdWorker processes CRD jobs concurrently
+func (s *Scanner) crdWorker(ctx context.Context, id int, jobs <-chan crdJob, results chan<- []Result, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	now := time.Now()
+
+	for job := range jobs {
+		// Check context cancellation
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		// Use pre-computed GVR
+		gvr := job.gvr
+
+		slog.Log(ctx, LevelTrace, "listing instances", "worker", id, "crd", job.name, "gvr", gvr.String())
+
+		spanCtx, span := tracer.Start(ctx, "list "+job.name, trace.WithAttributes(
+			attribute.String("crd", job.name),
+			attribute.String("gvr", gvr.String()),
+		))
+
+		start := time.Now()
+		s.inFlight.inc()
+
+		// List one page at a time so that only a page of instances is decoded in memory
+		items, pages, kept := 0, 0, 0
+		var err error
+		sequential := s.namespaces
+		if s.Incremental != nil || s.PerNamespace && len(s.namespaces) > 1 {
+			sequential = nil
+			if s.Incremental != nil {
+				items, pages, err = s.listIncremental(ctx, spanCtx, job, now, results)
+			} else {
+				items, pages, err = s.listFanOut(ctx, spanCtx, job, now, results)
+			}
+			if ctx.Err() != nil {
+				s.inFlight.dec()
+				endSpan(span, ctx.Err())
+				return
+			}
+		}
+	namespaces:
+		for i, namespace := range sequential {
+			opts := s.listOptions()
+			if s.LimitPerCRD > 0 && (opts.Limit == 0 || opts.Limit > s.LimitPerCRD) {
+				opts.Limit = s.LimitPerCRD
+			}
+			for {
+				var page listedPage
+				page, err = s.listPage(spanCtx, job, namespace, opts, now)
+				pages++
+				if err != nil {
+					break namespaces
+				}
+				items += page.items
+
+				// Stop at -limit-per-crd matches and record how many more there are
+				more := 0
+				if s.LimitPerCRD > 0 && int64(kept+len(page.results)) >= s.LimitPerCRD {
+					cut := kept + len(page.results) - int(s.LimitPerCRD)
+					page.results = page.results[:len(page.results)-cut]
+					more = cut
+					if page.next != "" || i < len(s.namespaces)-1 {
+						// Filters may reject any of the unlisted instances, so only an unfiltered
+						// list has an exact count; other namespaces are not counted at all
+						if page.remaining != nil && len(s.Filters) == 0 && !s.NearLimitOnly && i == len(s.namespaces)-1 {
+							more += int(*page.remaining)
+						} else {
+							more = MoreUnknown
+						}
+					}
+					page.next = ""
+				}
+				kept += len(page.results)
+				if more != 0 {
+					s.overflowMu.Lock()
+					if s.Overflow == nil {
+						s.Overflow = map[string]int{}
+					}
+					s.Overflow[job.name] = more
+					s.overflowMu.Unlock()
+				}
+
+				if len(page.results) > 0 {
+					select {
+					case results <- page.results:
+					case <-ctx.Done():
+						s.inFlight.dec()
+						endSpan(span, ctx.Err())
+						return
+					}
+				}
+				if more != 0 {
+					break namespaces
+				}
+				if page.next == "" {
+					break
+				}
+				// The continue token carries the resourceVersion of the first page
+				opts.Continue, opts.ResourceVersion = page.next, ""
+			}
+		}
+		s.inFlight.dec()
+		s.progress.crdDone()
+		span.SetAttributes(attribute.Int("items", items), attribute.Int("pages", pages))
+		endSpan(span, err)
+		s.timingsMu.Lock()
+		s.Stats.Latencies[job.name] = time.Since(start)
+		s.timingsMu.Unlock()
+		if s.Debug {
+			s.recordTiming(job, start, items, pages, err)
+		}
+
+		if err != nil {
+			// Skip CRDs that error out
+			s.listErrors.Add(1)
+			s.failuresMu.Lock()
+			s.Stats.ListFailures = append(s.Stats.ListFailures, Problem{CRD: job.name, Message: err.Error(), Reason: string(apierrors.ReasonForError(err))})
+			s.failuresMu.Unlock()
+			slog.Debug("skipping CRD that could not be listed", "crd", job.name, "error", err)
+			continue
+		}
+		slog.Log(ctx, LevelAll, "listed instances", "crd", job.name, "items", items, "pages", pages)
+	}
+}
+
+// listOptions returns the options of the first list call of a resource type.
+func (s *Scanner) listOptions() metav1.ListOptions {
+	opts := metav1.ListOptions{Limit: s.ChunkSize}
+	if s.FromCache {
+		opts.ResourceVersion = "0"
+	}
+	if s.ServerTimeout > 0 {
+		seconds := int64((s.ServerTimeout + time.Second - 1) / time.Second)
+		opts.TimeoutSeconds = &seconds
+	}
+	return opts
+}
+
+// namespaceFanOut is how many namespaces of one resource type PerNamespace lists at once.
+// The workers list several resource types at a time as well, and the client's QPS limit
+// bounds the total.
+const namespaceFanOut = 8
+
+// listFanOut lists job's instances in each of s.namespaces, namespaceFanOut at a time,
+// and sends the results as they arrive. It returns the instances and pages listed and
+// the first error, which stops the namespaces not yet listed.
+func (s *Scanner) listFanOut(ctx, spanCtx context.Context, job crdJob, now time.Time, results chan<- []Result) (items, pages int, err error) {
+	spanCtx, cancel := context.WithCancel(spanCtx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, namespaceFanOut)
+	for _, namespace := range s.namespaces {
+		select {
+		case slots <- struct{}{}:
+		case <-spanCtx.Done():
+		}
+		if spanCtx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			opts := s.listOptions()
+			for {
+				page, listErr := s.listPage(spanCtx, job, namespace, opts, now)
+				mu.Lock()
+				pages++
+				items += page.items
+				if listErr != nil && err == nil {
+					err = listErr
+					cancel()
+				}
+				mu.Unlock()
+				if listErr != nil {
+					return
+				}
+				if len(page.results) > 0 {
+					select {
+					case results <- page.results:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if page.next == "" {
+					return
+				}
+				// The continue token carries the resourceVersion of the first page
+				opts.Continue, opts.ResourceVersion = page.next, ""
+			}
+		}()
+	}
+	wg.Wait()
+	return items, pages, err
+}
+
+// listedPage is one page of a resource type's instances.
+type listedPage struct {
+	results   []Result // the instances that passed the filters
+	items     int      // all instances in the page
+	next      string   // continue token for the next page, empty after the last one
+	remaining *int64   // instances after this page, when the server can tell
+}
+
+// listPage lists one page of job's instances in namespace, or in all namespaces if it is
+// empty, and returns the matching results.
+func (s *Scanner) listPage(ctx context.Context, job crdJob, namespace string, opts metav1.ListOptions, now time.Time) (listedPage, error) {
+	resourceList, err := s.list(ctx, job, namespace, opts)
+	if err != nil {
+		return listedPage{}, err
+	}
+
+	page := listedPage{
+		items:     len(resourceList.Items),
+		next:      resourceList.GetContinue(),
+		remaining: resourceList.GetRemainingItemCount(),
+	}
+	for i := range resourceList.Items {
+		item := &resourceList.Items[i]
+		res, ok := s.newResult(ctx, job, item, now)
+		if !ok {
+			continue
+		}
+		if err := s.keepObject(&res, item); err != nil {
+			return listedPage{}, err
+		}
+		page.results = append(page.results, res)
+	}
+	return page, nil
+}
+
+// list makes one list call for job's instances in namespace, or in all namespaces if it
+// is empty.
+func (s *Scanner) list(ctx context.Context, job crdJob, namespace string, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	// Create a sub-context with a shorter timeout for individual requests, leaving the
+	// server time to end the request first when it is asked to
+	reqCtx, cancel := context.WithTimeout(ctx, max(5*time.Second, s.ServerTimeout+time.Second))
+	defer cancel()
+	reqCtx = context.WithValue(reqCtx, crdContextKey{}, job.name)
+	return s.resourceClient(job, namespace).List(reqCtx, opts)
+}
+
+// resourceClient returns the dynamic client for job's instances in namespace, or in all
+// namespaces if it is empty.
+func (s *Scanner) resourceClient(job crdJob, namespace string) dynamic.ResourceInterface {
+	if namespace == "" {
+		return s.DynamicClient.Resource(job.gvr)
+	}
+	return s.DynamicClient.Resource(job.gvr).Namespace(namespace)
+}
+
+// keepObject attaches item to res, or writes it to the Spool, when the scanner keeps
+// objects.
+func (s *Scanner) keepObject(res *Result, item *unstructured.Unstructured) error {
+	if !s.KeepObjects {
+		return nil
+	}
+	if s.Spool == nil {
+		res.Object = item
+		return nil
+	}
+	var err error
+	res.spooled, err = s.Spool.write(item)
+	return err
+}
+
+// newResult returns the result for item, an instance of job's resource type, or false if
+// the filters or NearLimitOnly leave it out. The object itself is not kept.
+func (s *Scanner) newResult(ctx context.Context, job crdJob, item *unstructured.Unstructured, now time.Time) (Result, bool) {
+	if !MatchesAll(ctx, s.Filters, item) {
+		return Result{}, false
+	}
+	gvr := job.gvr
+	res := Result{
+		CRDName:       job.name,
+		ResourceName:  gvr.Resource,
+		InstanceName:  item.GetName(),
+		Namespace:     item.GetNamespace(),
+		UID:           string(item.GetUID()),
+		GVR:           gvr,
+		Kind:          job.kind,
+		Source:        job.source,
+		CRD:           job.crd,
+		Created:       item.GetCreationTimestamp().Time,
+		Unhealthy:     isUnhealthy(item),
+		StuckDeleting: isStuckDeleting(item, now),
+	}
+	if s.JQColumn != nil {
+		value, err := s.JQColumn.extract(ctx, item)
+		if err != nil {
+			value = "<error>"
+		}
+		res.JQValue = value
+	}
+	if s.ComputeSize {
+		res.Size = objectSize(item)
+		if s.NearLimitOnly && res.Size < s.SizeWarning {
+			return Result{}, false
+		}
+	}
+	if len(s.ShowAnnotations) > 0 {
+		annotations := item.GetAnnotations()
+		res.Annotations = make(map[string]string, len(s.ShowAnnotations))
+		for _, key := range s.ShowAnnotations {
+			res.Annotations[key] = annotations[key]
+		}
+	}
+	if len(s.RequireLabels) > 0 {
+		res.MissingLabels = missingLabels(item, s.RequireLabels)
+	}
+	if s.ResolveSystems {
+		res.System = systemOf(item, gvr.Group)
+	}
+	return res, true
+}
+
+// recordTiming adds the outcome of one CRD's list calls to s.timings. Every request to the
+// list path beyond one per page is counted as a retry.
+func (s *Scanner) recordTiming(job crdJob, start time.Time, items, pages int, err error) {
+	t := crdTiming{crd: job.name, duration: time.Since(start), items: items, err: err}
+	n := 0
+	for _, namespace := range s.namespaces {
+		path := "/apis/" + job.gvr.Group + "/" + job.gvr.Version + "/" + job.gvr.Resource
+		if namespace != "" {
+			path = "/apis/" + job.gvr.Group + "/" + job.gvr.Version + "/namespaces/" + namespace + "/" + job.gvr.Resource
+		}
+		n += s.Metrics.pathRequests(path)
+	}
+	if n > pages {
+		t.retries = n - pages
+	}
+
+	s.timingsMu.Lock()
+	s.timings = append(s.timings, t)
+	s.timingsMu.Unlock()
+}
+
+// newCRDJob returns the job listing crd's instances at version.
+func newCRDJob(crd *apiextensionsv1.CustomResourceDefinition, version string) crdJob {
+	return crdJob{
+		name:          crd.Name,
+		kind:          crd.Spec.Names.Kind,
+		source:        SourceCRD,
+		crd:           crd,
+		storedVersion: version,
+		gvr: schema.GroupVersionResource{
+			Group:    crd.Spec.Group,
+			Version:  version,
+			Resource: crd.Spec.Names.Plural,
+		},
+	}
+}
+
+// listVersion returns the version to list crd's instances at: its storage version if it
+// is served, or else the newest served version, with a problem saying so. Listing a
+// version that is not served fails, so a CRD serving none is skipped with "".
+func listVersion(crd *apiextensionsv1.CustomResourceDefinition) (string, *Problem) {
+	stored := getStoredVersion(crd)
+	newest := ""
+	for _, v := range crd.Spec.Versions {
+		if !v.Served {
+			continue
+		}
+		if v.Name == stored {
+			return stored, nil
+		}
+		if newest == "" || version.CompareKubeAwareVersionStrings(v.Name, newest) > 0 {
+			newest = v.Name
+		}
+	}
+	if newest == "" {
+		return "", &Problem{CRD: crd.Name, Message: "skipped: no version is served"}
+	}
+	return newest, &Problem{CRD: crd.Name, Message: fmt.Sprintf("storage version %s is not served; listed %s instead", stored, newest)}
+}
+
+// getStoredVersion finds the version that is marked for storage.
+// This is typically the most stable or preferred version of the CRD.
+func getStoredVersion(crd *apiextensionsv1.CustomResourceDefinition) string {
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			return version.Name
+		}
+	}
+	// Fallback to the first version if no storage version is explicitly set
+	if len(crd.Spec.Versions) > 0 {
+		return crd.Spec.Versions[0].Name
+	}
+	return ""
+}
@@ -0,0 +1,1068 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// testCRD returns a CRD for kind in group with the given versions, the last one stored.
+func testCRD(group, kind, plural string, scope apiextensionsv1.ResourceScope, versions ...string) *apiextensionsv1.CustomResourceDefinition {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: plural + "." + group},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: kind, Plural: plural},
+			Scope: scope,
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			Conditions: []apiextensionsv1.CustomResourceDefinitionCondition{{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue}},
+		},
+	}
+	for i, v := range versions {
+		crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{
+			Name:    v,
+			Served:  true,
+			Storage: i == len(versions)-1,
+		})
+	}
+	return crd
+}
+
+// testInstance returns an instance of kind in group/version.
+func testInstance(group, version, kind, namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetAPIVersion(group + "/" + version)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// newTestScanner returns a Scanner over fake clients holding crds and instances.
+func newTestScanner(t *testing.T, crds []*apiextensionsv1.CustomResourceDefinition, instances ...*unstructured.Unstructured) *Scanner {
+	t.Helper()
+	var crdObjects []runtime.Object
+	listKinds := map[schema.GroupVersionResource]string{namespacesGVR: "NamespaceList", resourceQuotasGVR: "ResourceQuotaList"}
+	for _, crd := range crds {
+		crdObjects = append(crdObjects, crd)
+		for _, v := range crd.Spec.Versions {
+			gvr := schema.GroupVersionResource{Group: crd.Spec.Group, Version: v.Name, Resource: crd.Spec.Names.Plural}
+			listKinds[gvr] = crd.Spec.Names.Kind + "List"
+		}
+	}
+	var instanceObjects []runtime.Object
+	for _, obj := range instances {
+		instanceObjects = append(instanceObjects, obj)
+	}
+	return &Scanner{
+		APIExtensionsClient: apiextensionsfake.NewClientset(crdObjects...),
+		DynamicClient:       dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, instanceObjects...),
+	}
+}
+
+func resultNames(results []Result) []string {
+	names := make([]string, len(results))
+	for i, res := range results {
+		names[i] = res.Namespace + "/" + res.InstanceName
+	}
+	return names
+}
+
+func TestGetStoredVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []apiextensionsv1.CustomResourceDefinitionVersion
+		want     string
+	}{
+		{
+			name: "storage version",
+			versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1"}, {Name: "v1", Storage: true}, {Name: "v2"},
+			},
+			want: "v1",
+		},
+		{
+			name:     "no storage version falls back to the first",
+			versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1beta1"}, {Name: "v1"}},
+			want:     "v1beta1",
+		},
+		{
+			name: "no versions",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := &apiextensionsv1.CustomResourceDefinition{}
+			crd.Spec.Versions = tt.versions
+			if got := getStoredVersion(crd); got != tt.want {
+				t.Errorf("getStoredVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		versions    []apiextensionsv1.CustomResourceDefinitionVersion
+		want        string
+		wantProblem bool
+	}{
+		{
+			name:     "served storage version",
+			versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true}, {Name: "v2", Served: true}},
+			want:     "v1",
+		},
+		{
+			name: "unserved storage version falls back to the newest served",
+			versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Storage: true}, {Name: "v1beta2", Served: true}, {Name: "v1", Served: true}, {Name: "v1beta1", Served: true},
+			},
+			want:        "v1",
+			wantProblem: true,
+		},
+		{
+			name:        "nothing served",
+			versions:    []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Storage: true}},
+			want:        "",
+			wantProblem: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := &apiextensionsv1.CustomResourceDefinition{}
+			crd.Spec.Versions = tt.versions
+			got, problem := listVersion(crd)
+			if got != tt.want || (problem != nil) != tt.wantProblem {
+				t.Errorf("listVersion() = %q, %v, want %q with problem %v", got, problem, tt.want, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestScanListsStoredVersion(t *testing.T) {
+	crd := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1alpha1", "v1")
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{crd},
+		testInstance("example.com", "v1", "Widget", "default", "a", nil),
+	)
+	s.Namespace = "default"
+
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Scan() returned %d results, want 1", len(results))
+	}
+	res := results[0]
+	if res.GVR.Version != "v1" {
+		t.Errorf("GVR.Version = %q, want the stored version v1", res.GVR.Version)
+	}
+	if res.CRDName != "widgets.example.com" || res.Kind != "Widget" || res.Source != SourceCRD || res.CRD == nil {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestScanScoping(t *testing.T) {
+	crds := []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+		testCRD("example.com", "Cluster", "clusters", apiextensionsv1.ClusterScoped, "v1"),
+	}
+	instances := []*unstructured.Unstructured{
+		testInstance("example.com", "v1", "Widget", "default", "a", nil),
+		testInstance("example.com", "v1", "Widget", "prod", "b", nil),
+		testInstance("example.com", "v1", "Cluster", "", "c", nil),
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		allNamespaces bool
+		want          []string
+	}{
+		{name: "one namespace", namespace: "prod", want: []string{"prod/b"}},
+		{name: "all namespaces", namespace: "prod", allNamespaces: true, want: []string{"default/a", "prod/b"}},
+		{name: "empty namespace lists everywhere", want: []string{"default/a", "prod/b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScanner(t, crds, instances...)
+			s.Namespace = tt.namespace
+			s.AllNamespaces = tt.allNamespaces
+
+			results, err := s.Scan(context.Background())
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if got := resultNames(results); !slices.Equal(got, tt.want) {
+				t.Errorf("Scan() = %v, want %v", got, tt.want)
+			}
+			if s.Stats.CRDs != 2 || s.Stats.Skipped != 1 {
+				t.Errorf("Stats = %+v, want 2 CRDs with the cluster-scoped one skipped", s.Stats)
+			}
+		})
+	}
+}
+
+func TestScanNoNamespacedCRDs(t *testing.T) {
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("example.com", "Cluster", "clusters", apiextensionsv1.ClusterScoped, "v1"),
+	})
+	if _, err := s.Scan(context.Background()); !errors.Is(err, ErrNoNamespacedCRDs) {
+		t.Errorf("Scan() error = %v, want ErrNoNamespacedCRDs", err)
+	}
+}
+
+func TestScanFilters(t *testing.T) {
+	widgets := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1")
+	widgets.Spec.Names.Categories = []string{"all"}
+	gadgets := testCRD("example.com", "Gadget", "gadgets", apiextensionsv1.NamespaceScoped, "v1")
+	crds := []*apiextensionsv1.CustomResourceDefinition{widgets, gadgets}
+	instances := []*unstructured.Unstructured{
+		testInstance("example.com", "v1", "Widget", "default", "small", map[string]interface{}{"replicas": int64(1)}),
+		testInstance("example.com", "v1", "Widget", "default", "large", map[string]interface{}{"replicas": int64(5)}),
+		testInstance("example.com", "v1", "Gadget", "default", "gadget", map[string]interface{}{"replicas": int64(5)}),
+	}
+	instances[0].SetAnnotations(map[string]string{"example.com/paused": "true"})
+	instances[2].SetAnnotations(map[string]string{"example.com/paused": "false"})
+
+	celFilter, err := NewCELFilter("object.spec.replicas > 3")
+	if err != nil {
+		t.Fatalf("NewCELFilter() error = %v", err)
+	}
+	jqFilter, err := NewJQQuery(".spec.replicas == 1")
+	if err != nil {
+		t.Fatalf("NewJQQuery() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(s *Scanner)
+		want  []string
+	}{
+		{name: "no filters", setup: func(s *Scanner) {}, want: []string{"default/gadget", "default/large", "default/small"}},
+		{name: "kinds", setup: func(s *Scanner) { s.Kinds = map[string]bool{"gadget": true} }, want: []string{"default/gadget"}},
+		{name: "category", setup: func(s *Scanner) { s.Category = "all" }, want: []string{"default/large", "default/small"}},
+		{name: "cel", setup: func(s *Scanner) { s.Filters = []Filter{celFilter} }, want: []string{"default/gadget", "default/large"}},
+		{name: "jq", setup: func(s *Scanner) { s.Filters = []Filter{jqFilter} }, want: []string{"default/small"}},
+		{
+			name:  "annotation",
+			setup: func(s *Scanner) { s.Filters = []Filter{NewAnnotationFilter("example.com/paused", "true")} },
+			want:  []string{"default/small"},
+		},
+		{
+			name:  "has annotation",
+			setup: func(s *Scanner) { s.Filters = []Filter{NewHasAnnotationFilter("example.com/paused")} },
+			want:  []string{"default/gadget", "default/small"},
+		},
+		{name: "name", setup: func(s *Scanner) { s.Filters = []Filter{NewNameFilter("LAR")} }, want: []string{"default/large"}},
+		{
+			name:  "filters combine",
+			setup: func(s *Scanner) { s.Filters = []Filter{celFilter}; s.Category = "all" },
+			want:  []string{"default/large"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScanner(t, crds, instances...)
+			s.Namespace = "default"
+			tt.setup(s)
+
+			results, err := s.Scan(context.Background())
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if got := resultNames(results); !slices.Equal(got, tt.want) {
+				t.Errorf("Scan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanJQColumn(t *testing.T) {
+	crd := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1")
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{crd},
+		testInstance("example.com", "v1", "Widget", "default", "a", map[string]interface{}{"url": "https://example.com"}),
+	)
+	s.Namespace = "default"
+	var err error
+	if s.JQColumn, err = NewJQQuery(".spec.url"); err != nil {
+		t.Fatalf("NewJQQuery() error = %v", err)
+	}
+
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(results) != 1 || results[0].JQValue != "https://example.com" {
+		t.Errorf("Scan() = %+v, want one result with JQValue https://example.com", results)
+	}
+}
+
+func TestScanDefaultOrder(t *testing.T) {
+	crds := []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("b.example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+		testCRD("a.example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+	}
+	s := newTestScanner(t, crds,
+		testInstance("b.example.com", "v1", "Widget", "prod", "y", nil),
+		testInstance("b.example.com", "v1", "Widget", "default", "z", nil),
+		testInstance("a.example.com", "v1", "Widget", "prod", "x", nil),
+		testInstance("a.example.com", "v1", "Widget", "prod", "w", nil),
+	)
+	s.AllNamespaces = true
+
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	var got []string
+	for _, res := range results {
+		got = append(got, res.CRDName+" "+res.Namespace+"/"+res.InstanceName)
+	}
+	want := []string{
+		"widgets.a.example.com prod/w",
+		"widgets.a.example.com prod/x",
+		"widgets.b.example.com default/z",
+		"widgets.b.example.com prod/y",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Scan() order = %v, want %v", got, want)
+	}
+}
+
+func TestScanOnResults(t *testing.T) {
+	crds := []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("a.example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+		testCRD("b.example.com", "Gadget", "gadgets", apiextensionsv1.NamespaceScoped, "v1"),
+	}
+	s := newTestScanner(t, crds,
+		testInstance("a.example.com", "v1", "Widget", "prod", "x", nil),
+		testInstance("a.example.com", "v1", "Widget", "prod", "y", nil),
+		testInstance("b.example.com", "v1", "Gadget", "prod", "z", nil),
+	)
+	s.Namespace = "prod"
+	var streamed []string
+	s.OnResults = func(results []Result) {
+		for _, res := range results {
+			streamed = append(streamed, res.InstanceName)
+		}
+	}
+
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	// Pages arrive in whatever order the workers finish them
+	slices.Sort(streamed)
+	if want := []string{"x", "y", "z"}; !slices.Equal(streamed, want) {
+		t.Errorf("OnResults got %v, want %v", streamed, want)
+	}
+	if len(results) != 3 {
+		t.Errorf("Scan() returned %d results after streaming, want 3", len(results))
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	now := time.Now()
+	// Already in the default order, as Scan returns them
+	results := []Result{
+		{CRDName: "a.example.com", Namespace: "prod", InstanceName: "c", GVR: schema.GroupVersionResource{Group: "example.com"}, Created: now.Add(-time.Hour)},
+		{CRDName: "b.other.io", Namespace: "default", InstanceName: "a", GVR: schema.GroupVersionResource{Group: "other.io"}, Created: now},
+		{CRDName: "c.example.com", Namespace: "prod", InstanceName: "b", GVR: schema.GroupVersionResource{Group: "example.com"}, Created: now.Add(-time.Minute)},
+	}
+
+	tests := []struct {
+		key     string
+		reverse bool
+		want    []string
+	}{
+		{key: "crd", want: []string{"c", "a", "b"}},
+		{key: "crd", reverse: true, want: []string{"b", "a", "c"}},
+		{key: "name", want: []string{"a", "b", "c"}},
+		{key: "namespace", want: []string{"a", "c", "b"}},
+		{key: "age", want: []string{"a", "b", "c"}},
+		{key: "age", reverse: true, want: []string{"c", "b", "a"}},
+		{key: "group", want: []string{"c", "b", "a"}},
+	}
+	for _, tt := range tests {
+		sorted := append([]Result(nil), results...)
+		SortResults(sorted, tt.key, tt.reverse)
+		var got []string
+		for _, res := range sorted {
+			got = append(got, res.InstanceName)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SortResults(%q, reverse=%v) = %v, want %v", tt.key, tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestSortResultsByCount(t *testing.T) {
+	results := []Result{
+		{CRDName: "a.example.com", InstanceName: "a1"},
+		{CRDName: "b.example.com", InstanceName: "b1"},
+		{CRDName: "b.example.com", InstanceName: "b2"},
+		{CRDName: "c.example.com", InstanceName: "c1"},
+	}
+	for _, tt := range []struct {
+		reverse bool
+		want    []string
+	}{
+		// Ties keep the default order
+		{want: []string{"b1", "b2", "a1", "c1"}},
+		{reverse: true, want: []string{"a1", "c1", "b1", "b2"}},
+	} {
+		sorted := append([]Result(nil), results...)
+		SortResults(sorted, "count", tt.reverse)
+		var got []string
+		for _, res := range sorted {
+			got = append(got, res.InstanceName)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SortResults(count, reverse=%v) = %v, want %v", tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestScanSpoolsObjects(t *testing.T) {
+	crd := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1")
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{crd},
+		testInstance("example.com", "v1", "Widget", "default", "a", map[string]interface{}{"replicas": int64(1)}),
+		testInstance("example.com", "v1", "Widget", "default", "b", map[string]interface{}{"replicas": int64(2)}),
+	)
+	s.Namespace = "default"
+	s.KeepObjects = true
+	s.Spool = NewSpool(t.TempDir())
+	defer s.Spool.Close()
+
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	for i, want := range []int64{1, 2} {
+		if results[i].Object != nil {
+			t.Errorf("result %d holds its object in memory with a Spool", i)
+		}
+		obj, err := results[i].LoadObject()
+		if err != nil {
+			t.Fatalf("LoadObject() error = %v", err)
+		}
+		if got, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas"); got != want {
+			t.Errorf("spooled %s has spec.replicas %d, want %d", obj.GetName(), got, want)
+		}
+	}
+}
+
+func TestScanLimitPerCRD(t *testing.T) {
+	crds := []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+		testCRD("example.com", "Gadget", "gadgets", apiextensionsv1.NamespaceScoped, "v1"),
+	}
+	s := newTestScanner(t, crds,
+		testInstance("example.com", "v1", "Widget", "default", "a", nil),
+		testInstance("example.com", "v1", "Widget", "default", "b", nil),
+		testInstance("example.com", "v1", "Widget", "default", "c", nil),
+		testInstance("example.com", "v1", "Gadget", "default", "d", nil),
+	)
+	s.Namespace = "default"
+	s.LimitPerCRD = 1
+
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got, want := resultNames(results), []string{"default/d", "default/a"}; !slices.Equal(got, want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+	if len(s.Overflow) != 1 || s.Overflow["widgets.example.com"] != 2 {
+		t.Errorf("Overflow = %v, want 2 more widgets only", s.Overflow)
+	}
+}
+
+func TestScanNamespaceRegex(t *testing.T) {
+	crds := []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+	}
+	var objects []*unstructured.Unstructured
+	for _, ns := range []string{"team-a-prod", "team-a-dev", "team-b-prod", "kube-system"} {
+		namespace := &unstructured.Unstructured{}
+		namespace.SetAPIVersion("v1")
+		namespace.SetKind("Namespace")
+		namespace.SetName(ns)
+		objects = append(objects, namespace, testInstance("example.com", "v1", "Widget", ns, "w", nil))
+	}
+
+	s := newTestScanner(t, crds, objects...)
+	s.AllNamespaces = true
+	s.NamespaceRegex = regexp.MustCompile(`^team-.*-prod$`)
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got, want := resultNames(results), []string{"team-a-prod/w", "team-b-prod/w"}; !slices.Equal(got, want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+
+	s.NamespaceRegex = regexp.MustCompile(`^staging-`)
+	if _, err := s.Scan(context.Background()); err == nil {
+		t.Error("Scan() with no matching namespace succeeded, want an error")
+	}
+}
+
+func TestScanPerNamespace(t *testing.T) {
+	crds := []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+		testCRD("example.com", "Gadget", "gadgets", apiextensionsv1.NamespaceScoped, "v1"),
+	}
+	var objects []*unstructured.Unstructured
+	var want []string
+	for i := range 20 {
+		ns := fmt.Sprintf("ns-%02d", i)
+		namespace := &unstructured.Unstructured{}
+		namespace.SetAPIVersion("v1")
+		namespace.SetKind("Namespace")
+		namespace.SetName(ns)
+		objects = append(objects, namespace, testInstance("example.com", "v1", "Widget", ns, "w", nil))
+		want = append(want, ns+"/w")
+	}
+	objects = append(objects, testInstance("example.com", "v1", "Gadget", "ns-03", "g", nil))
+	want = append([]string{"ns-03/g"}, want...)
+
+	s := newTestScanner(t, crds, objects...)
+	s.AllNamespaces = true
+	s.PerNamespace = true
+	s.ChunkSize = 1
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := resultNames(results); !slices.Equal(got, want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+}
+
+func TestScanNotEstablished(t *testing.T) {
+	widgets := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1")
+	gadgets := testCRD("example.com", "Gadget", "gadgets", apiextensionsv1.NamespaceScoped, "v1")
+	gadgets.Status.Conditions = []apiextensionsv1.CustomResourceDefinitionCondition{
+		{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionFalse, Reason: "Installing", Message: "the initial names have not been accepted"},
+	}
+	instances := []*unstructured.Unstructured{
+		testInstance("example.com", "v1", "Widget", "default", "a", nil),
+		testInstance("example.com", "v1", "Gadget", "default", "b", nil),
+	}
+
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{widgets, gadgets}, instances...)
+	s.AllNamespaces = true
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got, want := resultNames(results), []string{"default/a"}; !slices.Equal(got, want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+	if len(s.Stats.Problems) != 1 || s.Stats.Problems[0].CRD != "gadgets.example.com" || !strings.Contains(s.Stats.Problems[0].Message, "Installing") {
+		t.Errorf("Stats.Problems = %+v, want gadgets skipped as Installing", s.Stats.Problems)
+	}
+
+	// With -wait-established, a CRD that becomes Established while waiting is scanned
+	establishedPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { establishedPollInterval = time.Second })
+	s = newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{widgets, gadgets}, instances...)
+	s.AllNamespaces = true
+	s.WaitEstablished = 5 * time.Second
+	established := gadgets.DeepCopy()
+	established.Status.Conditions[0].Status = apiextensionsv1.ConditionTrue
+	s.APIExtensionsClient.(*apiextensionsfake.Clientset).PrependReactor("get", "customresourcedefinitions", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, established, nil
+	})
+	results, err = s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got, want := resultNames(results), []string{"default/b", "default/a"}; !slices.Equal(got, want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+	if len(s.Stats.Problems) != 0 {
+		t.Errorf("Stats.Problems = %+v, want none", s.Stats.Problems)
+	}
+}
+
+func TestScanListFailures(t *testing.T) {
+	crds := []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+		testCRD("example.com", "Gadget", "gadgets", apiextensionsv1.NamespaceScoped, "v1"),
+	}
+	s := newTestScanner(t, crds, testInstance("example.com", "v1", "Widget", "default", "a", nil))
+	s.AllNamespaces = true
+	s.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "gadgets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "example.com", Resource: "gadgets"}, "", errors.New("RBAC denied"))
+	})
+
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got, want := resultNames(results), []string{"default/a"}; !slices.Equal(got, want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+	if s.Stats.ListErrors != 1 || len(s.Stats.ListFailures) != 1 || s.Stats.ListFailures[0].CRD != "gadgets.example.com" || s.Stats.ListFailures[0].Reason != "Forbidden" {
+		t.Errorf("Stats.ListFailures = %+v, want gadgets Forbidden", s.Stats.ListFailures)
+	}
+	// The failed CRD was still scanned
+	if len(s.CRDs) != 2 {
+		t.Errorf("CRDs = %d, want 2", len(s.CRDs))
+	}
+	// Gates must not count the failed CRD as empty
+	if err := s.Stats.CheckComplete(); !errors.Is(err, ErrIncomplete) || !strings.Contains(err.Error(), "gadgets.example.com") {
+		t.Errorf("CheckComplete() = %v, want ErrIncomplete naming gadgets", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	crd := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1")
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{crd},
+		testInstance("example.com", "v1", "Widget", "default", "a", nil),
+	)
+	s.Namespace = "default"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan Event, 10)
+	results, err := s.Watch(ctx, 5*time.Second, func(ev Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if got, want := resultNames(results), []string{"default/a"}; !slices.Equal(got, want) {
+		t.Errorf("Watch() = %v, want %v", got, want)
+	}
+
+	widgets := s.DynamicClient.Resource(schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}).Namespace("default")
+	if _, err := widgets.Create(ctx, testInstance("example.com", "v1", "Widget", "default", "b", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := widgets.Delete(ctx, "a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ADDED default/b", "DELETED default/a"} {
+		select {
+		case ev := <-events:
+			if got := string(ev.Type) + " " + ev.Result.Namespace + "/" + ev.Result.InstanceName; got != want {
+				t.Errorf("event = %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event, want %q", want)
+		}
+	}
+}
+
+func TestWatchHandlerRelist(t *testing.T) {
+	var events []EventType
+	s := &Scanner{}
+	h := s.watchHandler(context.Background(), crdJob{name: "widgets.example.com", kind: "Widget"}, func(t EventType, _ Result) { events = append(events, t) })
+
+	old := testInstance("example.com", "v1", "Widget", "default", "a", nil)
+	old.SetResourceVersion("1")
+	// A relist notifies an update of the unchanged object
+	h.OnUpdate(old, old.DeepCopy())
+	if len(events) != 0 {
+		t.Errorf("events after a relist = %v, want none", events)
+	}
+	changed := old.DeepCopy()
+	changed.SetResourceVersion("2")
+	h.OnUpdate(old, changed)
+	if !slices.Equal(events, []EventType{Modified}) {
+		t.Errorf("events after an update = %v, want MODIFIED", events)
+	}
+}
+
+// crdMetadata returns a fake metadata client listing crds at the given resourceVersion.
+func crdMetadata(t *testing.T, resourceVersion string, crds ...*apiextensionsv1.CustomResourceDefinition) *metadatafake.FakeMetadataClient {
+	t.Helper()
+	scheme := metadatafake.NewTestScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	var objects []runtime.Object
+	for _, crd := range crds {
+		objects = append(objects, &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1", Kind: "CustomResourceDefinition"},
+			ObjectMeta: metav1.ObjectMeta{Name: crd.Name, ResourceVersion: resourceVersion},
+		})
+	}
+	return metadatafake.NewSimpleMetadataClient(scheme, objects...)
+}
+
+func TestRateLimiterCountsWaits(t *testing.T) {
+	m := NewAPIMetrics()
+	limiter := m.RateLimiter(flowcontrol.NewTokenBucketRateLimiter(1000, 1))
+	for range 3 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	// The burst of one lets the first request through at once
+	if _, _, waits, waited := m.totals(); waits != 2 || waited <= 0 {
+		t.Errorf("totals() = %d waits, %s waited, want 2 waits", waits, waited)
+	}
+}
+
+func TestScanCRDCache(t *testing.T) {
+	crd := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1")
+	crd.ResourceVersion = "1"
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{crd},
+		testInstance("example.com", "v1", "Widget", "default", "a", nil),
+	)
+	s.Namespace = "default"
+	s.CRDCache = filepath.Join(t.TempDir(), "discovery", "crds.json")
+	s.MetadataClient = crdMetadata(t, "1", crd)
+
+	if _, err := s.Scan(context.Background()); err != nil {
+		t.Fatalf("first Scan() error = %v", err)
+	}
+
+	// The cached list is used while the resourceVersions match, even if the CRD list
+	// call would now return nothing
+	s.APIExtensionsClient = apiextensionsfake.NewClientset()
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("cached Scan() error = %v", err)
+	}
+	if got, want := resultNames(results), []string{"default/a"}; !slices.Equal(got, want) {
+		t.Errorf("cached Scan() = %v, want %v", got, want)
+	}
+
+	// A changed resourceVersion invalidates the cache
+	s.MetadataClient = crdMetadata(t, "2", crd)
+	if _, err := s.Scan(context.Background()); !errors.Is(err, ErrNoNamespacedCRDs) {
+		t.Errorf("Scan() after the CRD changed error = %v, want ErrNoNamespacedCRDs from a fresh list", err)
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	results := []Result{
+		{CRDName: "backups.velero.io", Kind: "Backup", Object: testInstance("velero.io", "v1", "Backup", "velero", "a", nil)},
+		{CRDName: "backups.velero.io", Kind: "Backup", Object: testInstance("velero.io", "v1", "Backup", "velero", "b", nil)},
+		{CRDName: "widgets.example.com", Kind: "Widget"},
+	}
+	results[1].Object.Object["status"] = map[string]interface{}{"phase": "Failed"}
+
+	failed, err := NewCELFilter(`has(object.status) && object.status.phase == "Failed"`)
+	if err != nil {
+		t.Fatalf("NewCELFilter() error = %v", err)
+	}
+	tests := []struct {
+		name      string
+		threshold Threshold
+		want      []string
+	}{
+		{"by CRD name", Threshold{CRD: "backups.velero.io", Max: 1}, []string{"backups.velero.io=2"}},
+		{"by Kind", Threshold{CRD: "backup", Max: 2}, nil},
+		{"any CRD", Threshold{CRD: AnyCRD, Max: 0}, []string{"backups.velero.io=2", "widgets.example.com=1"}},
+		{"where", Threshold{CRD: "backups.velero.io", Where: "failed", Max: 0, filter: failed}, []string{"backups.velero.io=1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := CheckThresholds(context.Background(), []Threshold{tt.threshold}, results)
+			if err != nil {
+				t.Fatalf("CheckThresholds() error = %v", err)
+			}
+			var got []string
+			for _, v := range violations {
+				got = append(got, fmt.Sprintf("%s=%d", v.CRD, v.Count))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("CheckThresholds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	if got, err := ParseThreshold("backups.velero.io=0"); err != nil || got.CRD != "backups.velero.io" || got.Max != 0 {
+		t.Errorf("ParseThreshold() = %+v, %v", got, err)
+	}
+	for _, spec := range []string{"backups.velero.io", "=3", "x=-1", "x=many"} {
+		if _, err := ParseThreshold(spec); err == nil {
+			t.Errorf("ParseThreshold(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestSuspendedBy(t *testing.T) {
+	annotated := func(annotations map[string]string) *unstructured.Unstructured {
+		obj := testInstance("example.com", "v1", "Widget", "default", "a", map[string]interface{}{})
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+	tests := []struct {
+		name string
+		obj  *unstructured.Unstructured
+		want string
+	}{
+		{name: "running", obj: testInstance("example.com", "v1", "Widget", "default", "a", map[string]interface{}{"suspend": false}), want: ""},
+		{name: "suspend", obj: testInstance("example.com", "v1", "Widget", "default", "a", map[string]interface{}{"suspend": true}), want: "spec.suspend"},
+		{name: "paused", obj: testInstance("example.com", "v1", "Widget", "default", "a", map[string]interface{}{"paused": true}), want: "spec.paused"},
+		{name: "annotation value", obj: annotated(map[string]string{"crossplane.io/paused": "true"}), want: "annotation crossplane.io/paused"},
+		{name: "other annotation value", obj: annotated(map[string]string{"crossplane.io/paused": "false"}), want: ""},
+		{name: "annotation presence", obj: annotated(map[string]string{"cluster.x-k8s.io/paused": ""}), want: "annotation cluster.x-k8s.io/paused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SuspendedBy(tt.obj); got != tt.want {
+				t.Errorf("SuspendedBy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaLimits(t *testing.T) {
+	crd := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1")
+	quota := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec":   map[string]interface{}{"hard": map[string]interface{}{"count/widgets.example.com": "10", "count/gadgets.example.com": "5", "pods": "20"}},
+		"status": map[string]interface{}{"used": map[string]interface{}{"count/widgets.example.com": "9"}},
+	}}
+	quota.SetAPIVersion("v1")
+	quota.SetKind("ResourceQuota")
+	quota.SetNamespace("default")
+	quota.SetName("objects")
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{crd}, quota,
+		testInstance("example.com", "v1", "Widget", "default", "a", nil))
+	s.Namespace = "default"
+	if _, err := s.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	limits, err := s.QuotaLimits(context.Background())
+	if err != nil {
+		t.Fatalf("QuotaLimits() error = %v", err)
+	}
+	want := []QuotaLimit{{Namespace: "default", Quota: "objects", CRD: "widgets.example.com", Hard: 10, Used: 9}}
+	if !slices.Equal(limits, want) {
+		t.Errorf("QuotaLimits() = %+v, want %+v", limits, want)
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	crds := []*apiextensionsv1.CustomResourceDefinition{
+		testCRD("cert-manager.io", "Certificate", "certificates", apiextensionsv1.NamespaceScoped, "v1"),
+		testCRD("networking.internal.knative.dev", "Certificate", "certificates", apiextensionsv1.NamespaceScoped, "v1alpha1"),
+		testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1"),
+	}
+	var items []apiextensionsv1.CustomResourceDefinition
+	for _, crd := range crds {
+		items = append(items, *crd)
+	}
+	both := []string{"certificates.cert-manager.io", "certificates.networking.internal.knative.dev"}
+	want := []Collision{{Name: "Certificate", Field: "kind", CRDs: both}, {Name: "certificates", Field: "resource", CRDs: both}}
+	if got := FindCollisions(items); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindCollisions() = %+v, want %+v", got, want)
+	}
+
+	s := newTestScanner(t, crds,
+		testInstance("cert-manager.io", "v1", "Certificate", "default", "cm", nil),
+		testInstance("networking.internal.knative.dev", "v1alpha1", "Certificate", "default", "knative", nil),
+	)
+	s.Namespace = "default"
+	s.Kinds = map[string]bool{"certificate.cert-manager.io": true}
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got, want := resultNames(results), []string{"default/cm"}; !slices.Equal(got, want) {
+		t.Errorf("Scan() with Kind.group = %v, want %v", got, want)
+	}
+	if len(s.Collisions) != 2 {
+		t.Errorf("Scanner.Collisions = %+v, want 2", s.Collisions)
+	}
+}
+
+func TestKindMatches(t *testing.T) {
+	tests := []struct {
+		selector, kind, group string
+		want                  bool
+	}{
+		{"certificate", "Certificate", "cert-manager.io", true},
+		{"Certificate.cert-manager.io", "Certificate", "cert-manager.io", true},
+		{"certificate.cert-manager.io", "Certificate", "acme.example.com", false},
+		{"Issuer", "Certificate", "cert-manager.io", false},
+	}
+	for _, tt := range tests {
+		if got := KindMatches(tt.selector, tt.kind, tt.group); got != tt.want {
+			t.Errorf("KindMatches(%q, %q, %q) = %v, want %v", tt.selector, tt.kind, tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestScanRecordsWarnings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Add("Warning", `299 - "example.com/v1beta1 Widget is deprecated; use example.com/v1"`)
+		fmt.Fprint(w, `{"apiVersion":"example.com/v1beta1","kind":"WidgetList","metadata":{},"items":[]}`)
+	}))
+	defer srv.Close()
+
+	crd := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1beta1")
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{crd})
+	s.Warnings = NewWarningRecorder()
+	var err error
+	s.DynamicClient, err = dynamic.NewForConfig(&rest.Config{Host: srv.URL, WarningHandlerWithContext: s.Warnings})
+	if err != nil {
+		t.Fatalf("dynamic.NewForConfig() error = %v", err)
+	}
+	s.Namespace = "default"
+	for range 2 {
+		if _, err := s.Scan(context.Background()); err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+	}
+	want := []APIWarning{{CRD: "widgets.example.com", Text: "example.com/v1beta1 Widget is deprecated; use example.com/v1", Count: 1}}
+	if !reflect.DeepEqual(s.Stats.Warnings, want) {
+		t.Errorf("Stats.Warnings = %+v, want %+v", s.Stats.Warnings, want)
+	}
+}
+
+func TestCELCostLimit(t *testing.T) {
+	f, err := NewCELFilter("object.spec.items.all(x, object.spec.items.all(y, x == y || x != y))")
+	if err != nil {
+		t.Fatalf("NewCELFilter() error = %v", err)
+	}
+	items := make([]interface{}, 1000)
+	for i := range items {
+		items[i] = int64(i)
+	}
+	obj := testInstance("example.com", "v1", "Widget", "default", "huge", map[string]interface{}{"items": items})
+	if _, err := f.matches(context.Background(), obj); err == nil || !strings.Contains(err.Error(), "cost limit") {
+		t.Errorf("matches() error = %v, want the cost limit exceeded", err)
+	}
+}
+
+func TestScanIncremental(t *testing.T) {
+	widget := func(name, resourceVersion string) string {
+		return fmt.Sprintf(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":%q,"namespace":"default","resourceVersion":%q}}`, name, resourceVersion)
+	}
+	var watches []string
+	// The current resourceVersions read before each watch: nothing changed between the
+	// second and third scans
+	current := []string{"12", "12", "14"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("limit") == "1" {
+			fmt.Fprintf(w, `{"apiVersion":"example.com/v1","kind":"WidgetList","metadata":{"resourceVersion":%q},"items":[%s]}`, current[0], widget("a", "5"))
+			current = current[1:]
+			return
+		}
+		if r.URL.Query().Get("watch") != "true" {
+			fmt.Fprintf(w, `{"apiVersion":"example.com/v1","kind":"WidgetList","metadata":{"resourceVersion":"10"},"items":[%s]}`, widget("a", "5"))
+			return
+		}
+		rv := r.URL.Query().Get("resourceVersion")
+		watches = append(watches, rv)
+		switch rv {
+		case "10":
+			// The changes arrive a while after the watch starts, and must not be missed
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(300 * time.Millisecond)
+			fmt.Fprintf(w, `{"type":"ADDED","object":%s}`+"\n", widget("b", "11"))
+			fmt.Fprintf(w, `{"type":"DELETED","object":%s}`+"\n", widget("a", "12"))
+			fmt.Fprint(w, `{"type":"BOOKMARK","object":{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"resourceVersion":"13"}}}`+"\n")
+		default:
+			fmt.Fprint(w, `{"type":"ERROR","object":{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Expired","code":410,"message":"too old resource version"}}`+"\n")
+		}
+	}))
+	defer srv.Close()
+
+	crd := testCRD("example.com", "Widget", "widgets", apiextensionsv1.NamespaceScoped, "v1")
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{crd})
+	var err error
+	s.DynamicClient, err = dynamic.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("dynamic.NewForConfig() error = %v", err)
+	}
+	s.Namespace = "default"
+	dir := filepath.Join(t.TempDir(), "state")
+
+	// Each scan starts from the state the previous one saved. The watch ends once it
+	// reaches the current resourceVersion, before the bookmark.
+	for i, want := range [][]string{{"a"}, {"b"}, {"b"}, {"a"}} {
+		s.Incremental = NewIncrementalState(dir)
+		results, err := s.Scan(context.Background())
+		if err != nil {
+			t.Fatalf("Scan() #%d error = %v", i+1, err)
+		}
+		var got []string
+		for _, res := range results {
+			got = append(got, res.InstanceName)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Scan() #%d = %v, want %v", i+1, got, want)
+		}
+	}
+	if want := []string{"10", "12"}; !slices.Equal(watches, want) {
+		t.Errorf("watched from resourceVersions %v, want %v", watches, want)
+	}
+	if s.Stats.Synced != 0 {
+		t.Errorf("Stats.Synced after an expired resourceVersion = %d, want 0", s.Stats.Synced)
+	}
+}
+
+func TestGroupBySystem(t *testing.T) {
+	certs := testCRD("cert-manager.io", "Certificate", "certificates", apiextensionsv1.NamespaceScoped, "v1")
+	topics := testCRD("kafka.strimzi.io", "KafkaTopic", "kafkatopics", apiextensionsv1.NamespaceScoped, "v1")
+	instances := []*unstructured.Unstructured{
+		testInstance("cert-manager.io", "v1", "Certificate", "default", "web-tls", nil),
+		testInstance("cert-manager.io", "v1", "Certificate", "default", "mesh-ca", nil),
+		testInstance("kafka.strimzi.io", "v1", "KafkaTopic", "default", "orders", nil),
+		testInstance("kafka.strimzi.io", "v1", "KafkaTopic", "default", "payments", nil),
+	}
+	instances[1].SetLabels(map[string]string{partOfLabel: "istio", nameLabel: "istiod"})
+	instances[2].SetLabels(map[string]string{nameLabel: "kafka"})
+	s := newTestScanner(t, []*apiextensionsv1.CustomResourceDefinition{certs, topics}, instances...)
+	s.Namespace = "default"
+	s.ResolveSystems = true
+
+	results, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	got := map[string][]string{}
+	for _, g := range GroupBySystem(results) {
+		got[g.Name] = resultNames(g.Results)
+	}
+	want := map[string][]string{
+		"cert-manager.io":  {"default/web-tls"},
+		"istio":            {"default/mesh-ca"},
+		"kafka":            {"default/orders"},
+		"kafka.strimzi.io": {"default/payments"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupBySystem() = %v, want %v", got, want)
+	}
+}
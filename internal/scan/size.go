@@ -0,0 +1,17 @@
+package scan
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// objectSize returns the size of obj serialized as JSON, which is close to what the API
+// server stores in etcd and sends over watches.
+func objectSize(obj *unstructured.Unstructured) int {
+	b, err := json.Marshal(obj.Object)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
@@ -0,0 +1,44 @@
+package scan
+
+import (
+	"cmp"
+	"sort"
+)
+
+// SortKeys are the accepted -sort-by values. Each compares one field; ties fall back to
+// the default CRD, resource, namespace, name order that Scan returns results in.
+var SortKeys = map[string]func(a, b *Result) int{
+	"name":      func(a, b *Result) int { return cmp.Compare(a.InstanceName, b.InstanceName) },
+	"namespace": func(a, b *Result) int { return cmp.Compare(a.Namespace, b.Namespace) },
+	"crd":       func(a, b *Result) int { return cmp.Compare(a.CRDName, b.CRDName) },
+	"group":     func(a, b *Result) int { return cmp.Compare(a.GVR.Group, b.GVR.Group) },
+	// Youngest first, like reading an AGE column top to bottom
+	"age": func(a, b *Result) int { return b.Created.Compare(a.Created) },
+	// Largest CRDs first; the counts need the whole result set, so SortResults builds this
+	"count": nil,
+}
+
+// byCRDCount compares results by the number of results of their CRD, most first.
+func byCRDCount(results []Result) func(a, b *Result) int {
+	counts := map[string]int{}
+	for i := range results {
+		counts[results[i].CRDName]++
+	}
+	return func(a, b *Result) int { return counts[b.CRDName] - counts[a.CRDName] }
+}
+
+// SortResults orders results by key, which must be one of SortKeys, optionally reversed.
+// results must already be in the default order so ties stay stable.
+func SortResults(results []Result, key string, reverse bool) {
+	compare := SortKeys[key]
+	if key == "count" {
+		compare = byCRDCount(results)
+	}
+	if reverse {
+		forward := compare
+		compare = func(a, b *Result) int { return forward(b, a) }
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return compare(&results[i], &results[j]) < 0
+	})
+}
@@ -0,0 +1,91 @@
+package scan
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Spool holds the objects of a scan in a temporary file instead of memory, so that commands
+// that need every instance, such as -o json, stay within a bounded amount of memory on
+// clusters with 100k+ custom resources. Each result keeps only its offset into the file.
+type Spool struct {
+	dir string
+
+	mu   sync.Mutex
+	file *os.File // created on the first write
+	size int64
+}
+
+// spoolRef locates one object written to a Spool.
+type spoolRef struct {
+	spool  *Spool
+	offset int64
+	length int
+}
+
+// NewSpool returns a Spool whose file is created in dir, or the default temporary
+// directory if dir is empty. No file is created until an object is written.
+func NewSpool(dir string) *Spool {
+	return &Spool{dir: dir}
+}
+
+// write appends obj to the spool as JSON.
+func (sp *Spool) write(obj *unstructured.Unstructured) (spoolRef, error) {
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return spoolRef{}, err
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.file == nil {
+		sp.file, err = os.CreateTemp(sp.dir, "kgcr-*.spool")
+		if err != nil {
+			return spoolRef{}, fmt.Errorf("creating spool file: %w", err)
+		}
+		// Unlink right away so the file is cleaned up however the process exits
+		os.Remove(sp.file.Name())
+	}
+	if _, err := sp.file.WriteAt(data, sp.size); err != nil {
+		return spoolRef{}, fmt.Errorf("writing spool file: %w", err)
+	}
+	ref := spoolRef{spool: sp, offset: sp.size, length: len(data)}
+	sp.size += int64(len(data))
+	return ref, nil
+}
+
+// read decodes the object at ref.
+func (sp *Spool) read(ref spoolRef) (*unstructured.Unstructured, error) {
+	sp.mu.Lock()
+	file := sp.file
+	sp.mu.Unlock()
+	if file == nil {
+		return nil, fmt.Errorf("reading spool file: spool is closed")
+	}
+
+	data := make([]byte, ref.length)
+	if _, err := file.ReadAt(data, ref.offset); err != nil {
+		return nil, fmt.Errorf("reading spool file: %w", err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("decoding spooled object: %w", err)
+	}
+	return obj, nil
+}
+
+// Close releases the spool file. Results that reference it can no longer load their objects.
+func (sp *Spool) Close() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.file == nil {
+		return nil
+	}
+	err := sp.file.Close()
+	sp.file = nil
+	sp.size = 0
+	return err
+}
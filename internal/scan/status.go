@@ -0,0 +1,35 @@
+package scan
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// stuckDeletionAfter is how long an instance may sit with a deletionTimestamp before it is
+// considered stuck, usually on a finalizer whose controller is gone.
+const stuckDeletionAfter = 5 * time.Minute
+
+// healthConditions are the condition types whose False status marks an instance unhealthy.
+var healthConditions = map[string]bool{"Ready": true, "Available": true, "Healthy": true}
+
+// isUnhealthy reports whether obj has a Ready, Available or Healthy condition that is False.
+func isUnhealthy(obj *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, _ := condition["type"].(string); healthConditions[t] && condition["status"] == "False" {
+			return true
+		}
+	}
+	return false
+}
+
+// isStuckDeleting reports whether obj was marked for deletion more than stuckDeletionAfter ago.
+func isStuckDeleting(obj *unstructured.Unstructured, now time.Time) bool {
+	deleted := obj.GetDeletionTimestamp()
+	return deleted != nil && now.Sub(deleted.Time) > stuckDeletionAfter
+}
@@ -0,0 +1,53 @@
+package scan
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// suspendFields are the spec fields that pause reconciliation when true: spec.suspend in
+// Flux sources, kustomizations and helm releases and in Argo Workflows, and spec.paused in
+// Argo Rollouts and Cluster API.
+var suspendFields = [][]string{{"spec", "suspend"}, {"spec", "paused"}}
+
+// suspendAnnotations are the annotations that pause reconciliation, with the value that
+// does so, or "" when their presence alone does.
+var suspendAnnotations = []struct{ key, value string }{
+	{"argocd.argoproj.io/skip-reconcile", "true"},
+	{"kustomize.toolkit.fluxcd.io/reconcile", "disabled"},
+	{"fluxcd.io/ignore", "true"},
+	{"crossplane.io/paused", "true"},
+	{"autoscaling.keda.sh/paused", "true"},
+	{"cluster.x-k8s.io/paused", ""},
+}
+
+// SuspendedBy returns the field or annotation that pauses the reconciliation of obj, e.g.
+// "spec.suspend" or "annotation crossplane.io/paused", or "" if none does.
+func SuspendedBy(obj *unstructured.Unstructured) string {
+	for _, field := range suspendFields {
+		if suspended, found, _ := unstructured.NestedBool(obj.Object, field...); found && suspended {
+			return field[0] + "." + field[1]
+		}
+	}
+	annotations := obj.GetAnnotations()
+	for _, a := range suspendAnnotations {
+		if value, ok := annotations[a.key]; ok && (a.value == "" || value == a.value) {
+			return "annotation " + a.key
+		}
+	}
+	return ""
+}
+
+// suspendedFilter keeps the instances whose reconciliation is paused.
+type suspendedFilter struct{}
+
+// NewSuspendedFilter keeps the instances SuspendedBy finds paused, to find reconciliation
+// that was paused during an incident and never resumed.
+func NewSuspendedFilter() Filter {
+	return suspendedFilter{}
+}
+
+func (suspendedFilter) matches(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	return SuspendedBy(obj) != "", nil
+}
@@ -0,0 +1,162 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// AnyCRD in a Threshold's CRD applies its limit to every CRD on its own.
+const AnyCRD = "*"
+
+// Threshold is a limit on the number of instances of a CRD, for failing CI runs, e.g. at
+// most 0 Failed Velero backups or at most 500 instances of any single CRD.
+type Threshold struct {
+	// CRD is a CRD name (backups.velero.io), a case-insensitive Kind (Backup), or Kind.group
+	// (Backup.velero.io) when several groups share the Kind, or AnyCRD
+	CRD string `json:"crd"`
+	// Where is an optional CEL expression; only the instances it is true for count
+	Where string `json:"where,omitempty"`
+	Max   int    `json:"max"`
+
+	filter Filter
+}
+
+// ThresholdFile is the file -thresholds reads, in YAML or JSON:
+//
+//	thresholds:
+//	- crd: backups.velero.io
+//	  where: object.status.phase == "Failed"
+//	  max: 0
+//	- crd: "*"
+//	  max: 500
+type ThresholdFile struct {
+	Thresholds []Threshold `json:"thresholds"`
+}
+
+// ParseThreshold parses the -max-count form, crd=max.
+func ParseThreshold(spec string) (Threshold, error) {
+	crd, max, ok := strings.Cut(spec, "=")
+	n, err := strconv.Atoi(strings.TrimSpace(max))
+	if !ok || strings.TrimSpace(crd) == "" || err != nil || n < 0 {
+		return Threshold{}, fmt.Errorf("expected <crd>=<max count>, got %q", spec)
+	}
+	return Threshold{CRD: strings.TrimSpace(crd), Max: n}, nil
+}
+
+// LoadThresholds reads a ThresholdFile and compiles the Where expressions in it.
+func LoadThresholds(path string) ([]Threshold, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file ThresholdFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("reading thresholds from %s: %w", path, err)
+	}
+	for i := range file.Thresholds {
+		t := &file.Thresholds[i]
+		if t.CRD == "" || t.Max < 0 {
+			return nil, fmt.Errorf("reading thresholds from %s: threshold %d needs a crd and a max of at least 0", path, i+1)
+		}
+		if t.Where != "" {
+			if t.filter, err = NewCELFilter(t.Where); err != nil {
+				return nil, fmt.Errorf("reading thresholds from %s: threshold %d: %w", path, i+1, err)
+			}
+		}
+	}
+	return file.Thresholds, nil
+}
+
+// NeedsObjects reports whether checking thresholds loads the full instances, so the scan
+// must keep them.
+func NeedsObjects(thresholds []Threshold) bool {
+	for _, t := range thresholds {
+		if t.Where != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesCRD reports whether res is an instance of the CRD t names.
+func (t *Threshold) matchesCRD(res *Result) bool {
+	return t.CRD == AnyCRD || t.CRD == res.CRDName || strings.EqualFold(t.CRD, res.Kind) || strings.EqualFold(t.CRD, res.Kind+"."+res.GVR.Group)
+}
+
+// Violation is a CRD with more matching instances than a Threshold allows.
+type Violation struct {
+	Threshold *Threshold
+	CRD       string
+	Count     int
+}
+
+// String describes v, e.g. `backups.velero.io where object.status.phase == "Failed": count 3
+// exceeds the limit of 0`.
+func (v *Violation) String() string {
+	s := v.CRD
+	if v.Threshold.Where != "" {
+		s += " where " + v.Threshold.Where
+	}
+	return fmt.Sprintf("%s: count %d exceeds the limit of %d", s, v.Count, v.Threshold.Max)
+}
+
+// CheckThresholds counts the matching instances of each threshold in results, per CRD,
+// and returns those above their limit, sorted by CRD. Instances a Where expression cannot
+// evaluate do not count.
+func CheckThresholds(ctx context.Context, thresholds []Threshold, results []Result) ([]Violation, error) {
+	var violations []Violation
+	for i := range thresholds {
+		t := &thresholds[i]
+		counts := map[string]int{}
+		for j := range results {
+			res := &results[j]
+			if !t.matchesCRD(res) {
+				continue
+			}
+			if t.filter != nil {
+				obj, err := res.LoadObject()
+				if err != nil {
+					return nil, err
+				}
+				if !MatchesAll(ctx, []Filter{t.filter}, obj) {
+					continue
+				}
+			}
+			counts[res.CRDName]++
+		}
+		var over []Violation
+		for crd, n := range counts {
+			if n > t.Max {
+				over = append(over, Violation{Threshold: t, CRD: crd, Count: n})
+			}
+		}
+		sort.Slice(over, func(a, b int) bool { return over[a].CRD < over[b].CRD })
+		violations = append(violations, over...)
+	}
+	return violations, nil
+}
+
+// ErrIncomplete is returned by CheckComplete when resource types could not be listed.
+var ErrIncomplete = errors.New("scan incomplete")
+
+// CheckComplete returns an ErrIncomplete error naming the resource types the scan could
+// not list. Their instances are unknown rather than none, so a CI gate must not pass or
+// fail on the counts of such a scan.
+func (st *Stats) CheckComplete() error {
+	if len(st.ListFailures) == 0 {
+		return nil
+	}
+	crds := make([]string, len(st.ListFailures))
+	for i, p := range st.ListFailures {
+		crds[i] = p.CRD
+	}
+	sort.Strings(crds)
+	return fmt.Errorf("%w: %d resource types could not be listed: %s", ErrIncomplete, len(crds), strings.Join(crds, ", "))
+}
@@ -0,0 +1,83 @@
+package scan
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// crdContextKey carries the name of the CRD a request lists, so WarningRecorder can tell
+// which CRD a warning is about.
+type crdContextKey struct{}
+
+// APIWarning is a warning header the API server returned, such as a deprecated version or
+// an admission webhook warning, with how many responses carried it.
+type APIWarning struct {
+	CRD   string `json:"crd,omitempty"` // empty for requests not about one CRD, e.g. listing CRDs
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// WarningRecorder is a rest.Config WarningHandlerWithContext that collects the API
+// server's warnings by CRD, instead of printing each one as client-go does by default.
+type WarningRecorder struct {
+	mu     sync.Mutex
+	counts map[APIWarning]int // keyed by CRD and text, with Count 0
+}
+
+func NewWarningRecorder() *WarningRecorder {
+	return &WarningRecorder{counts: map[APIWarning]int{}}
+}
+
+// HandleWarningHeaderWithContext records a warning from a response to a request made
+// with ctx.
+func (r *WarningRecorder) HandleWarningHeaderWithContext(ctx context.Context, code int, agent, text string) {
+	// 299 is the only code the API server sends; others come from proxies in between
+	if code != 299 || text == "" {
+		return
+	}
+	crd, _ := ctx.Value(crdContextKey{}).(string)
+	r.mu.Lock()
+	r.counts[APIWarning{CRD: crd, Text: text}]++
+	r.mu.Unlock()
+}
+
+// reset forgets the warnings recorded so far, at the start of a scan.
+// A nil r, as for offline clients, records nothing.
+func (r *WarningRecorder) reset() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	clear(r.counts)
+	r.mu.Unlock()
+}
+
+// warnings returns the recorded warnings sorted by CRD and text.
+func (r *WarningRecorder) warnings() []APIWarning {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var warnings []APIWarning
+	for w, n := range r.counts {
+		w.Count = n
+		warnings = append(warnings, w)
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].CRD != warnings[j].CRD {
+			return warnings[i].CRD < warnings[j].CRD
+		}
+		return warnings[i].Text < warnings[j].Text
+	})
+	return warnings
+}
+
+// logWarnings logs each warning of the last scan, for -show-warnings.
+func (s *Scanner) logWarnings() {
+	for _, w := range s.Stats.Warnings {
+		slog.Warn("API server warning", "crd", w.CRD, "warning", w.Text, "responses", w.Count)
+	}
+}
@@ -0,0 +1,201 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EventType says how a matching instance changed while watching.
+type EventType string
+
+const (
+	Added    EventType = "ADDED"
+	Modified EventType = "MODIFIED"
+	Deleted  EventType = "DELETED"
+)
+
+// Event is a change to a matching instance seen by Watch after the initial sync.
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Result Result
+}
+
+// watchedType is the informer for one resource type in one namespace, or in all of them.
+type watchedType struct {
+	job      crdJob
+	informer cache.SharedIndexInformer
+	cancel   context.CancelFunc
+}
+
+// Watch starts a shared informer per scanned resource type, so the instances stay current
+// through watches instead of repeated lists, and returns them once the informers have
+// synced, sorted like Scan's. Resource types that cannot be listed within syncTimeout are
+// left out and reported in Stats.Problems and Stats.ListFailures; Stats.Latencies holds how
+// long the others took to sync.
+//
+// Until ctx is done, onChange is then called, one event at a time, for every matching
+// instance added, modified or deleted. An instance that starts or stops matching the
+// filters counts as added or deleted.
+func (s *Scanner) Watch(ctx context.Context, syncTimeout time.Duration, onChange func(Event)) ([]Result, error) {
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	jobs, err := s.resourceJobs(syncCtx)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("watching custom resources", "resourceTypes", len(jobs), "crds", s.Stats.CRDs, "namespace", s.Namespace)
+
+	// Events are dropped until the initial results are taken from the synced caches,
+	// which already hold them
+	var mu sync.Mutex
+	started := false
+	emit := func(typ EventType, res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if started {
+			onChange(Event{Type: typ, Time: time.Now(), Result: res})
+		}
+	}
+
+	var watched []watchedType
+	for _, job := range jobs {
+		for _, namespace := range s.namespaces {
+			w := watchedType{
+				job:      job,
+				informer: dynamicinformer.NewFilteredDynamicInformer(s.DynamicClient, job.gvr, namespace, 0, cache.Indexers{}, nil).Informer(),
+			}
+			if err := w.informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+				slog.Debug("watch failed", "crd", job.name, "error", err)
+			}); err != nil {
+				return nil, err
+			}
+			if _, err := w.informer.AddEventHandler(s.watchHandler(ctx, job, emit)); err != nil {
+				return nil, err
+			}
+			watched = append(watched, w)
+		}
+	}
+	start := time.Now()
+	for i := range watched {
+		var informerCtx context.Context
+		informerCtx, watched[i].cancel = context.WithCancel(ctx)
+		go watched[i].informer.RunWithContext(informerCtx)
+	}
+
+	// Wait for the informers together, so each one's latency is the time its own
+	// initial list took
+	syncedAt := make([]time.Duration, len(watched))
+	var wg sync.WaitGroup
+	for i := range watched {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cache.WaitForCacheSync(syncCtx.Done(), watched[i].informer.HasSynced) {
+				syncedAt[i] = time.Since(start)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var synced []watchedType
+	failed := map[string]bool{}
+	for i, w := range watched {
+		if syncedAt[i] > 0 {
+			synced = append(synced, w)
+			s.Stats.Latencies[w.job.name] = max(s.Stats.Latencies[w.job.name], syncedAt[i])
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Stop retrying a resource type that could not be listed, as Scan skips it
+		w.cancel()
+		if !failed[w.job.name] {
+			failed[w.job.name] = true
+			s.Stats.ListErrors++
+			p := Problem{CRD: w.job.name, Message: fmt.Sprintf("skipped: not listed and watched within %s", syncTimeout)}
+			s.Stats.Problems = append(s.Stats.Problems, p)
+			s.Stats.ListFailures = append(s.Stats.ListFailures, p)
+			slog.Warn("CRD not scanned as expected", "crd", p.CRD, "problem", p.Message)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	var results []Result
+	for _, w := range synced {
+		for _, obj := range w.informer.GetStore().List() {
+			item := obj.(*unstructured.Unstructured)
+			if res, ok := s.newResult(ctx, w.job, item, now); ok {
+				if s.KeepObjects {
+					res.Object = item
+				}
+				results = append(results, res)
+			}
+		}
+	}
+	SortDefault(results)
+	s.Stats.ResourceTypes = len(jobs)
+	s.Stats.Instances = len(results)
+	s.Stats.WallTime = time.Since(start)
+	started = true
+	return results, nil
+}
+
+// watchHandler turns informer notifications for job's instances into events for the
+// instances matching the filters.
+func (s *Scanner) watchHandler(ctx context.Context, job crdJob, emit func(EventType, Result)) cache.ResourceEventHandler {
+	result := func(obj interface{}) (Result, bool) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		item, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return Result{}, false
+		}
+		res, ok := s.newResult(ctx, job, item, time.Now())
+		if ok && s.KeepObjects {
+			res.Object = item
+		}
+		return res, ok
+	}
+	return cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if res, ok := result(obj); ok && !isInInitialList {
+				emit(Added, res)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// A relist notifies an update of every stored object, changed or not
+			oldItem, oldOK := oldObj.(*unstructured.Unstructured)
+			newItem, newOK := newObj.(*unstructured.Unstructured)
+			if oldOK && newOK && oldItem.GetResourceVersion() == newItem.GetResourceVersion() {
+				return
+			}
+			oldRes, wasMatching := result(oldObj)
+			newRes, matching := result(newObj)
+			switch {
+			case wasMatching && matching:
+				emit(Modified, newRes)
+			case matching:
+				emit(Added, newRes)
+			case wasMatching:
+				emit(Deleted, oldRes)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if res, ok := result(obj); ok {
+				emit(Deleted, res)
+			}
+		},
+	}
+}